@@ -2,6 +2,7 @@ package conf
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -14,8 +15,11 @@ var Ip string
 type App struct {
 	Name      string
 	CpuNumber int
-	Debug     bool
-	Port      string
+	// serves pprof on Port
+	Debug bool
+	Port  string
+	// serves the metrics of the exporter itself on Port/metrics, also served in Debug
+	Metrics bool
 }
 
 type Config struct {
@@ -36,12 +40,16 @@ type Info struct {
 }
 
 type LogFile struct {
-	Flush       int    `json:"flush,omitempty"`
-	Save        int    `json:"save,omitempty"`
-	List        []List `json:"list,omitempty"`
-	Check       int    `json:"check,omitempty"`
-	Ttl         int    `json:"ttl,omitempty"`
+	Flush int    `json:"flush,omitempty"`
+	Save  int    `json:"save,omitempty"`
+	List  []List `json:"list,omitempty"`
+	Check int    `json:"check,omitempty"`
+	Ttl   int    `json:"ttl,omitempty"`
+	// minute, a file no longer tailed is forgotten after it, 60 when not set
+	Expire      int    `json:"expire,omitempty"`
 	PositionDir string `json:"positionDir,omitempty"`
+	// json rewrites PositionDir on every save, kv appends the changes to PositionDir.kv
+	PositionStore string `json:"positionStore,omitempty"`
 }
 
 type List struct {
@@ -51,6 +59,135 @@ type List struct {
 	Buff           int      `json:"buff,omitempty"`
 	RulerName      string   `json:"rulerName,omitempty"`
 	ResolveKeyWord []string `json:"resolveKeyWord,omitempty"`
+	MatchType      string   `json:"matchType,omitempty"`
+	// a line matched KeyWords but also ExcludeKeyWords is dropped
+	ExcludeKeyWords []string   `json:"excludeKeyWords,omitempty"`
+	Multiline       *Multiline `json:"multiline,omitempty"`
+	// text, json, logfmt or grok, the formats other than text parse a line into fields
+	Format string `json:"format,omitempty"`
+	// the pattern of grok format, like %{IP:client} %{NUMBER:status}
+	GrokPattern string `json:"grokPattern,omitempty"`
+	// logstash pattern files loaded on top of the built in patterns
+	GrokPatternFiles []string    `json:"grokPatternFiles,omitempty"`
+	Fields           []FieldRule `json:"fields,omitempty"`
+	// fields sent as extra labels, at most 100 distinct values each
+	LabelFields []string `json:"labelFields,omitempty"`
+	// fields or named capture groups of a regex keyword sent as extra labels
+	Labels []LabelRule `json:"labels,omitempty"`
+	// records a number of the line into a histogram
+	Value *ValueRule `json:"value,omitempty"`
+	// a keyword is only sent after Count matches within Window
+	Threshold *Threshold `json:"threshold,omitempty"`
+	// second, when set a match of KeyWords is a heartbeat and the alert fires once none is seen for so long
+	Absence int `json:"absence,omitempty"`
+	// sent as labels of every keyword of the rule
+	Severity string `json:"severity,omitempty"`
+	Summary  string `json:"summary,omitempty"`
+	Runbook  string `json:"runbook,omitempty"`
+	// overrides the severity, summary or runbook of a keyword
+	Annotations []Annotation `json:"annotations,omitempty"`
+	// samples take the time of the line instead of the time it is read
+	Timestamp *Timestamp `json:"timestamp,omitempty"`
+	// masks the ids and numbers of a matched line and labels it with the hash of the rest
+	Fingerprint *Fingerprint `json:"fingerprint,omitempty"`
+}
+
+type Fingerprint struct {
+	// second, the repeats of a fingerprint within it are sent once with their count, 0 sends every match
+	Window int `json:"window,omitempty"`
+	// distinct fingerprints over it are labeled "other", default 100
+	MaxValues int `json:"maxValues,omitempty"`
+}
+
+type Timestamp struct {
+	// a go layout like 2006-01-02 15:04:05.000 or one of iso8601, rfc3339, unix, unixms, common, syslog, default iso8601
+	Layout string `json:"layout,omitempty"`
+	// where the time is in the line, the first group if any, default is the layout at the start of the line,
+	// or anywhere for iso8601, rfc3339, common and syslog
+	Pattern string `json:"pattern,omitempty"`
+	// take the time from a field of json, logfmt or grok instead of Pattern
+	Field string `json:"field,omitempty"`
+	// time zone of a time without one, like Asia/Shanghai, default local
+	Location string `json:"location,omitempty"`
+	// now or drop, for a line without a time that can be parsed, default now
+	Missing string `json:"missing,omitempty"`
+	// second, a time older than it is more than the tsdb accepts, default 3600
+	MaxAge int `json:"maxAge,omitempty"`
+	// now or drop, for a time older than MaxAge, default now
+	TooOld string `json:"tooOld,omitempty"`
+}
+
+type Annotation struct {
+	KeyWord  string `json:"keyWord,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Summary  string `json:"summary,omitempty"`
+	Runbook  string `json:"runbook,omitempty"`
+}
+
+// Annotation of keyWord, what the keyword leaves empty comes from the rule
+func (l *List) Annotation(keyWord string) Annotation {
+	a := Annotation{
+		KeyWord:  keyWord,
+		Severity: l.Severity,
+		Summary:  l.Summary,
+		Runbook:  l.Runbook,
+	}
+	for _, v := range l.Annotations {
+		if v.KeyWord != keyWord {
+			continue
+		}
+		if v.Severity != "" {
+			a.Severity = v.Severity
+		}
+		if v.Summary != "" {
+			a.Summary = v.Summary
+		}
+		if v.Runbook != "" {
+			a.Runbook = v.Runbook
+		}
+	}
+	return a
+}
+
+type Threshold struct {
+	Count int `json:"count,omitempty"`
+	// second
+	Window int `json:"window,omitempty"`
+}
+
+type ValueRule struct {
+	// the named group value is the number and unit its unit, without value the first group is the number
+	Pattern string `json:"pattern,omitempty"`
+	// unit when the line has none: ns, us, ms, s, m, h, converted to seconds; empty keeps the number as it is
+	Unit string `json:"unit,omitempty"`
+	// metric name, default keyword_value
+	Name    string    `json:"name,omitempty"`
+	Buckets []float64 `json:"buckets,omitempty"`
+}
+
+type LabelRule struct {
+	Name string `json:"name,omitempty"`
+	// only these values are sent, the others become "other"
+	Allow []string `json:"allow,omitempty"`
+	// distinct values over it become "other", default 100
+	MaxValues int `json:"maxValues,omitempty"`
+}
+
+type FieldRule struct {
+	Field string `json:"field,omitempty"`
+	// ==, !=, contains, =~, exists
+	Op    string `json:"op,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+type Multiline struct {
+	// a line matching StartPattern begins a new event, without it every line not matching ContinuePattern does
+	StartPattern string `json:"startPattern,omitempty"`
+	// default ^(\s|at |Caused by)
+	ContinuePattern string `json:"continuePattern,omitempty"`
+	MaxLines        int    `json:"maxLines,omitempty"`
+	// millisecond, a pending event is flushed when no line comes in time
+	Timeout int `json:"timeout,omitempty"`
 }
 
 type Tsdb struct {
@@ -61,11 +198,14 @@ type Tsdb struct {
 	Bucket    int    `json:"bucket,omitempty"`
 }
 
-func init() {
+// Load reads the config file named by -c, or config/config.yaml, main calls it before anything else
+func Load() {
 	var (
 		cfgFile = pflag.StringP("config", "c", "", "config file")
 	)
 
+	// the flags of a subcommand like positions are parsed by the subcommand
+	pflag.CommandLine.ParseErrorsWhitelist.UnknownFlags = true
 	pflag.Parse()
 
 	if *cfgFile != "" {
@@ -86,20 +226,16 @@ func init() {
 		panic("load config error" + err.Error())
 	}
 	AppConfig = app
-	if len(app.LogFile.List) > 0 {
+	if app.LogFile != nil && len(app.LogFile.List) > 0 {
 		ConfigLogFile = make(map[string]*List, len(app.LogFile.List))
 		for _, v := range app.LogFile.List {
-			ConfigLogFile[v.AppName] = &List{
-				AppName:      v.AppName,
-				KeyWords:     v.KeyWords,
-				FilePosition: v.FilePosition,
-				Buff:         v.Buff,
-				RulerName:    v.RulerName,
-			}
+			v := v
+			ConfigLogFile[v.AppName] = &v
 		}
 	}
 
-	fmt.Println(viper.ConfigFileUsed())
-	fmt.Println("config output", AppConfig)
+	// stdout is left to the output of subcommands
+	fmt.Fprintln(os.Stderr, viper.ConfigFileUsed())
+	fmt.Fprintln(os.Stderr, "config output", AppConfig)
 
 }
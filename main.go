@@ -1,18 +1,24 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/hpcloud/tail"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/spf13/pflag"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/absence"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/counter"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/check"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/resolve"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/savepostion"
@@ -27,6 +33,11 @@ import (
 var l log.Logger
 
 func main() {
+	conf.Load()
+	if pflag.Arg(0) == "positions" {
+		os.Exit(positionsCommand(positionArgs()))
+	}
+
 	runtime.GOMAXPROCS(conf.AppConfig.App.CpuNumber)
 
 	ip, err := tool.GetIP()
@@ -44,13 +55,17 @@ func main() {
 
 	fileDirs := make([]string, 0, len(conf.AppConfig.LogFile.List))
 	appNames := make([]string, 0, len(conf.AppConfig.LogFile.List))
+	absenceRules := make([]absence.Option, 0, 1)
 
 	for _, v := range conf.AppConfig.LogFile.List {
 		fileDirs = append(fileDirs, v.FilePosition)
-		check.Insert(check.KeyAppName(v.FilePosition), v.AppName)
+		check.SetApp(v.AppName, v.FilePosition)
 		if len(v.ResolveKeyWord) > 0 {
 			appNames = append(appNames, v.AppName)
 		}
+		if v.Absence > 0 {
+			absenceRules = append(absenceRules, absence.WithRule(v.AppName, v.RulerName, time.Second*time.Duration(v.Absence)))
+		}
 	}
 
 	if err := tool.CreateDir(conf.AppConfig.Log.FilePosition); err != nil {
@@ -65,16 +80,28 @@ func main() {
 	nd := scan.NewDirs()
 	nd.Set(fileTarget)
 
-	sp := savepostion.NewSavePos(conf.AppConfig.LogFile.PositionDir, l)
+	sp, err := savepostion.NewSavePos(conf.AppConfig.LogFile.PositionDir, l,
+		savepostion.WithStore(conf.AppConfig.LogFile.PositionStore))
+	if err != nil {
+		level.Error(l).Log("open position store failed", err)
+		panic(err)
+	}
+	status, counts := loadState(sp)
 
 	for _, v := range conf.AppConfig.LogFile.List {
-		check.Insert(v.AppName, v.KeyWords)
+		v := v
+		if err := tailkeyword.CheckRule(&v); err != nil {
+			level.Error(l).Log("check rule failed, appname is", v.AppName, "err", err)
+			panic(err)
+		}
+		check.SetKeyWords(v.AppName, v.KeyWords)
 
 		level.Info(l).Log("app", v.AppName, "keyword", v.KeyWords)
 	}
 
 	ri := resolve.NewResolver(
 		resolve.WithAppName(appNames),
+		resolve.WithStatus(status),
 	)
 
 	ntl := tailkeyword.NewTailManager(true, l,
@@ -102,7 +129,11 @@ func main() {
 		limit.WithLog(l),
 	)
 
-	ntl.Do(ri, npr, lim)
+	cnt := counter.NewCounter(counter.WithValues(counts))
+	hist := counter.NewHistogram()
+	abs := absence.NewAbsence(absenceRules...)
+
+	ntl.Do(ri, npr, lim, cnt, hist, abs)
 	ntl.Reload(fileDirs)
 
 	signal.Notify(signalChan,
@@ -114,11 +145,17 @@ func main() {
 		// syscall.SIGQUIT, // Quit from keyboard, "kill -3"
 	)
 
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
 	if conf.AppConfig.App.Debug {
-
 		level.Info(l).Log("starting listen pprof,port", conf.AppConfig.App.Port)
+		mux.Handle("/debug/pprof/", http.DefaultServeMux)
+	}
+	// only debug listened before metrics, a deployment without either opens no port
+	if conf.AppConfig.App.Port != "" && (conf.AppConfig.App.Debug || conf.AppConfig.App.Metrics) {
+		level.Info(l).Log("starting listen metrics,port", conf.AppConfig.App.Port)
 		go func() {
-			level.Error(l).Log((http.ListenAndServe(conf.AppConfig.App.Port, nil)))
+			level.Error(l).Log("listen failed", http.ListenAndServe(conf.AppConfig.App.Port, mux))
 		}()
 	}
 	if conf.AppConfig.LogFile != nil {
@@ -127,20 +164,28 @@ func main() {
 		}
 		saveFileTime := time.NewTicker(time.Minute * time.Duration(conf.AppConfig.LogFile.Save))
 		scanFileTime := time.NewTicker(time.Minute * time.Duration(conf.AppConfig.LogFile.Check))
-		clearMap := time.NewTicker(time.Hour)
+		expire := time.Hour
+		if conf.AppConfig.LogFile.Expire > 0 {
+			expire = time.Minute * time.Duration(conf.AppConfig.LogFile.Expire)
+		}
+		clearMap := time.NewTicker(expire)
 		clearLimit := time.NewTicker(time.Hour)
 		resend := time.NewTicker(time.Minute)
+		flushCounter := time.NewTicker(time.Minute * time.Duration(tool.MaxNumber(conf.AppConfig.LogFile.Flush, 1)))
 		for {
 			select {
 			case <-signalChan:
 				level.Info(l).Log("saving tell info", "...")
 				savePostionInFile(sp, true)
+				saveState(sp, ri, cnt)
+				sp.Close()
 				level.Info(l).Log("closing", "...")
 				os.Exit(1)
 
 			case <-saveFileTime.C:
 				level.Info(l).Log("saving tell info", "position")
 				savePostionInFile(sp, false)
+				saveState(sp, ri, cnt)
 			case <-scanFileTime.C:
 				if err := ntl.Reload(fileDirs); err != nil {
 					level.Error(l).Log("reload dir err ", err)
@@ -148,18 +193,24 @@ func main() {
 
 			case <-clearMap.C:
 				level.Info(l).Log("clear fileInfoMap", "内容")
-				check.ExpireDelete(l)
+				check.Expire(l, expire)
+				forgetFiles(cnt, hist)
 			case <-clearLimit.C:
 				dirs := nd.Get()
 				level.Info(l).Log("clear dir limit in rate ", dirs)
 				lim.RangeDelete(dirs)
+			case <-flushCounter.C:
+				sendCounter(npr, cnt)
+				sendHistogram(npr, hist)
 			case <-resend.C:
+				sendAbsence(npr, abs)
 				ri.Range(func(appName string) {
 					npr.Send(float64(1),
-						tsdb.NewPromLabels(appName, savepostion.Get(appName).FileName,
+						tsdb.NewPromLabels(appName, conf.ConfigLogFile[appName].FilePosition,
 							conf.Ip,
 							tsdb.WithOthers(map[string][]string{"keywords": conf.ConfigLogFile[appName].KeyWords,
 								"rulerName": {conf.ConfigLogFile[appName].RulerName}}),
+							tailkeyword.WithAnnotation(conf.ConfigLogFile[appName], ""),
 						).
 							GenLabels(),
 					)
@@ -168,40 +219,181 @@ func main() {
 		}
 	}
 }
-func savePostionInFile(sp *savepostion.SavePos, kill bool) {
-	level.Debug(l).Log("saving", "position")
-	fis := make([]*savepostion.FIInput, 0, 20)
-	check.Range(func(k string, v any) {
-		ta, ok := v.(*tail.Tail)
+func sendAbsence(npr tsdb.PromRemoteInterface, abs absence.AbsenceInterface) {
+	firing, resolved := abs.Check(time.Now())
+	send := func(value float64, alerts []absence.Alert) {
+		for _, v := range alerts {
+			fileName := v.FileName
+			if fileName == "" {
+				fileName = conf.ConfigLogFile[v.AppName].FilePosition
+			}
+			level.Info(l).Log("absence app", v.AppName, "rulerName", v.RulerName, "last seen", v.Since, "value", value)
+			go npr.Send(value,
+				tsdb.NewPromLabels(v.AppName, fileName, conf.Ip,
+					tsdb.WithOthers(map[string][]string{"keywords": conf.ConfigLogFile[v.AppName].KeyWords,
+						"rulerName": {v.RulerName},
+						"absent":    {"true"}}),
+					tailkeyword.WithAnnotation(conf.ConfigLogFile[v.AppName], ""),
+				).
+					GenLabels(),
+			)
+		}
+	}
+	send(float64(1), firing)
+	send(float64(0), resolved)
+}
 
-		level.Debug(l).Log("range map", ta)
-		if ok {
+// forgetFiles drops the counts of the files the registry no longer knows, the saved counters follow on the next save
+func forgetFiles(cnt counter.CounterInterface, hist counter.HistogramInterface) {
+	known := func(fileName string) bool {
+		_, ok := check.Get(fileName)
+		return ok
+	}
+	counters := cnt.Delete(func(k counter.Key) bool { return !known(k.FileName) })
+	histograms := hist.Delete(func(k counter.HistogramKey) bool { return !known(k.FileName) })
+	level.Info(l).Log("forget counters of expired files", counters, "histograms", histograms)
+}
 
-			offset, err := ta.Tell()
-			appName := check.Get(check.KeyAppName(k)).(string)
-			fileName := ta.Filename
-			level.Debug(l).Log("appname", appName, "filename", fileName)
+func sendCounter(npr tsdb.PromRemoteInterface, cnt counter.CounterInterface) {
+	batch := make([]tsdb.Request, 0, 10)
+	cnt.Range(func(k counter.Key, value float64) {
+		batch = append(batch, tsdb.Request{
+			Value: value,
+			NewLabels: tsdb.NewPromLabels(k.AppName, k.FileName, conf.Ip,
+				tsdb.WithOthers(map[string][]string{"keywords": {k.KeyWord},
+					"rulerName": {k.RulerName}}),
+				tailkeyword.WithAnnotation(conf.ConfigLogFile[k.AppName], k.KeyWord),
+			).
+				GenLabels(),
+		})
+	})
+	level.Debug(l).Log("sending counter", len(batch))
+	go npr.SendBatch(counter.MetricName, counter.MetricHelp, prompb.MetricMetadata_COUNTER, batch)
+}
 
-			fi := savepostion.Get(appName)
+func sendHistogram(npr tsdb.PromRemoteInterface, hist counter.HistogramInterface) {
+	batches := make(map[string][]tsdb.Request, 2)
+	hist.Range(func(k counter.HistogramKey, h counter.HistogramValue) {
+		labels := func(other map[string][]string) []prompb.Label {
+			other["rulerName"] = []string{k.RulerName}
+			return tsdb.NewPromLabels(k.AppName, k.FileName, conf.Ip,
+				tsdb.WithOthers(other),
+				tailkeyword.WithAnnotation(conf.ConfigLogFile[k.AppName], ""),
+			).GenLabels()
+		}
+		batch := batches[k.Name]
+		for i, b := range h.Buckets {
+			batch = append(batch, tsdb.Request{
+				Name:      k.Name + "_bucket",
+				Value:     float64(h.Counts[i]),
+				NewLabels: labels(map[string][]string{"le": {strconv.FormatFloat(b, 'f', -1, 64)}}),
+			})
+		}
+		batches[k.Name] = append(batch,
+			tsdb.Request{
+				Name:      k.Name + "_bucket",
+				Value:     float64(h.Count),
+				NewLabels: labels(map[string][]string{"le": {"+Inf"}}),
+			},
+			tsdb.Request{
+				Name:      k.Name + "_sum",
+				Value:     h.Sum,
+				NewLabels: labels(map[string][]string{}),
+			},
+			tsdb.Request{
+				Name:      k.Name + "_count",
+				Value:     float64(h.Count),
+				NewLabels: labels(map[string][]string{}),
+			})
+	})
+	for name, batch := range batches {
+		level.Debug(l).Log("sending histogram", name, "series", len(batch))
+		go npr.SendBatch(name, "value taken from matched lines", prompb.MetricMetadata_HISTOGRAM, batch)
+	}
+}
 
-			if fi != nil {
-				level.Info(l).Log("get offset in file,offset is", fi.Offset, "filename is", fi.FileName)
-				if offset < fi.Offset {
-					offset = fi.Offset
-				}
-			}
-			if err != nil {
-				level.Warn(l).Log("offset error", err, "getting file ", "content")
-			}
+const (
+	bucketResolve = "resolve"
+	bucketCounter = "counter"
+)
 
-			level.Info(l).Log("getting current offset", offset, "filename", fileName)
-			fis = append(fis, &savepostion.FIInput{
-				FileName: fileName,
-				Offset:   offset,
-				AppName:  appName,
-			})
+// loadState takes back the resolve status and the counts the last run saved
+func loadState(sp *savepostion.SavePos) (map[string]resolve.Status, map[counter.Key]float64) {
+	status := make(map[string]resolve.Status)
+	err := sp.LoadState(bucketResolve, func(key string, value []byte) {
+		var s resolve.Status
+		if err := json.Unmarshal(value, &s); err == nil {
+			status[key] = s
+		}
+	})
+	if err != nil {
+		level.Error(l).Log("load resolve status failed", err)
+	}
+	counts := make(map[counter.Key]float64)
+	err = sp.LoadState(bucketCounter, func(key string, value []byte) {
+		var (
+			k counter.Key
+			v float64
+		)
+		if json.Unmarshal([]byte(key), &k) == nil && json.Unmarshal(value, &v) == nil {
+			counts[k] = v
+		}
+	})
+	if err != nil {
+		level.Error(l).Log("load counter failed", err)
+	}
+	level.Info(l).Log("loaded resolve status", len(status), "counters", len(counts))
+	return status, counts
+}
+
+func saveState(sp *savepostion.SavePos, ri resolve.ResolveInterface, cnt counter.CounterInterface) {
+	status := make(map[string][]byte)
+	for k, v := range ri.Status() {
+		status[k], _ = json.Marshal(v)
+	}
+	if err := sp.SaveState(bucketResolve, status); err != nil {
+		level.Error(l).Log("save resolve status failed", err)
+	}
+	counts := make(map[string][]byte)
+	cnt.Range(func(k counter.Key, value float64) {
+		key, _ := json.Marshal(k)
+		counts[string(key)], _ = json.Marshal(value)
+	})
+	if err := sp.SaveState(bucketCounter, counts); err != nil {
+		level.Error(l).Log("save counter failed", err)
+	}
+}
 
+func savePostionInFile(sp *savepostion.SavePos, kill bool) {
+	level.Debug(l).Log("saving", "position")
+	fis := make([]*savepostion.FIInput, 0, 20)
+	check.Range(func(v check.File) {
+		ta := v.Follower
+		level.Debug(l).Log("range map", ta)
+
+		appName := v.AppName
+		fileName := ta.Filename()
+		// the follower has no file open yet or between two files, what is saved stays
+		id, err := ta.Identity()
+		if err != nil {
+			level.Debug(l).Log("no file open, keep saved offset, filename", fileName, "err", err)
+			return
+		}
+		// where the follower is in the file it has open, a truncated file goes back to a smaller offset
+		offset, err := ta.Tell()
+		if err != nil {
+			level.Warn(l).Log("offset error", err, "getting file ", "content")
+			return
 		}
+		level.Debug(l).Log("appname", appName, "filename", fileName)
+
+		level.Info(l).Log("getting current offset", offset, "filename", fileName)
+		fis = append(fis, &savepostion.FIInput{
+			FileName: fileName,
+			Offset:   offset,
+			AppName:  appName,
+			Identity: id,
+		})
 	})
 	if len(fis) > 0 {
 		sp.PatchSave(fis)
@@ -0,0 +1,95 @@
+package absence
+
+import (
+	"sync"
+	"time"
+)
+
+type Key struct {
+	AppName   string
+	RulerName string
+}
+
+type Alert struct {
+	Key
+	// the last file the keyword was seen in, empty if never seen
+	FileName string
+	Since    time.Time
+}
+
+type AbsenceInterface interface {
+	Seen(appName, rulerName, fileName string)
+	// Check returns the rules silent for longer than their duration, and the ones firing before that are seen again
+	Check(now time.Time) (firing []Alert, resolved []Alert)
+}
+
+type watch struct {
+	duration time.Duration
+	lastSeen time.Time
+	fileName string
+	firing   bool
+	resolved bool
+}
+
+type Option func(*Absence)
+
+// Absence lives as long as the process, tailers come and go with the rescans
+type Absence struct {
+	lock   sync.Mutex
+	start  time.Time
+	watchs map[Key]*watch
+}
+
+func WithRule(appName, rulerName string, duration time.Duration) Option {
+	return func(a *Absence) {
+		a.watchs[Key{AppName: appName, RulerName: rulerName}] = &watch{
+			duration: duration,
+			lastSeen: a.start,
+		}
+	}
+}
+
+func NewAbsence(opt ...Option) AbsenceInterface {
+	a := &Absence{
+		start:  time.Now(),
+		watchs: make(map[Key]*watch),
+	}
+	for _, v := range opt {
+		v(a)
+	}
+	return a
+}
+
+func (a *Absence) Seen(appName, rulerName, fileName string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	w, ok := a.watchs[Key{AppName: appName, RulerName: rulerName}]
+	if !ok {
+		return
+	}
+	w.lastSeen = time.Now()
+	w.fileName = fileName
+	if w.firing {
+		w.firing = false
+		w.resolved = true
+	}
+}
+
+func (a *Absence) Check(now time.Time) (firing []Alert, resolved []Alert) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for k, w := range a.watchs {
+		alert := Alert{Key: k, FileName: w.fileName, Since: w.lastSeen}
+		if w.resolved {
+			w.resolved = false
+			resolved = append(resolved, alert)
+		}
+		if now.Sub(w.lastSeen) >= w.duration {
+			w.firing = true
+			firing = append(firing, alert)
+		}
+	}
+	return
+}
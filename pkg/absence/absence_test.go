@@ -0,0 +1,91 @@
+package absence
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func names(alerts []Alert) []string {
+	list := make([]string, 0, len(alerts))
+	for _, v := range alerts {
+		list = append(list, v.AppName+"/"+v.RulerName+"@"+v.FileName)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAbsence(t *testing.T) {
+	// one Absence for the process, the tailers of every rescan report to it
+	a := NewAbsence(
+		WithRule("app", "heartbeat", time.Hour),
+		WithRule("app", "job", time.Hour*2),
+	)
+	steps := []struct {
+		name string
+		// Seen before the check, app/ruler@file
+		seen  [][3]string
+		after time.Duration
+		// firing and resolved of the check after the seen ones
+		firing   []string
+		resolved []string
+	}{
+		{name: "quiet within duration", after: time.Minute * 30},
+		{name: "never seen fires", after: time.Hour, firing: []string{"app/heartbeat@"}},
+		{name: "both silent", after: time.Hour * 2, firing: []string{"app/heartbeat@", "app/job@"}},
+		{
+			name:     "seen resolves once",
+			seen:     [][3]string{{"app", "heartbeat", "a.log"}},
+			resolved: []string{"app/heartbeat@a.log"},
+		},
+		{name: "resolved is not sent again"},
+		{name: "silent again fires with the last file", after: time.Hour, firing: []string{"app/heartbeat@a.log"}},
+		{
+			// the tailer of a.log is gone with a reload, the one of the new file reports to the same rule
+			name:     "seen by the tailer after reload",
+			seen:     [][3]string{{"app", "heartbeat", "b.log"}, {"app", "job", "b.log"}},
+			resolved: []string{"app/heartbeat@b.log", "app/job@b.log"},
+		},
+		{name: "both fire again", after: time.Hour * 3, firing: []string{"app/heartbeat@b.log", "app/job@b.log"}},
+		{
+			name:   "unknown rule is ignored",
+			seen:   [][3]string{{"app", "other", "c.log"}, {"other", "heartbeat", "c.log"}},
+			after:  time.Hour * 3,
+			firing: []string{"app/heartbeat@b.log", "app/job@b.log"},
+		},
+	}
+	for _, v := range steps {
+		for _, s := range v.seen {
+			a.Seen(s[0], s[1], s[2])
+		}
+		firing, resolved := a.Check(time.Now().Add(v.after))
+		if got := names(firing); !equal(got, v.firing) {
+			t.Errorf("%s: firing %v, want %v", v.name, got, v.firing)
+		}
+		if got := names(resolved); !equal(got, v.resolved) {
+			t.Errorf("%s: resolved %v, want %v", v.name, got, v.resolved)
+		}
+	}
+}
+
+func TestAbsenceSince(t *testing.T) {
+	a := NewAbsence(WithRule("app", "heartbeat", time.Minute))
+	before := time.Now()
+	a.Seen("app", "heartbeat", "a.log")
+	firing, _ := a.Check(time.Now().Add(time.Minute))
+	if len(firing) != 1 || firing[0].Since.Before(before) || firing[0].FileName != "a.log" {
+		t.Fatalf("firing %+v", firing)
+	}
+}
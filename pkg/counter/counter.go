@@ -0,0 +1,84 @@
+package counter
+
+import (
+	"sync"
+)
+
+const (
+	MetricName = "keyword_appear_total"
+	MetricHelp = "how many times a keyword appeared"
+)
+
+// Key is what a counter is kept for
+type Key struct {
+	AppName   string
+	FileName  string
+	KeyWord   string
+	RulerName string
+}
+
+type CounterInterface interface {
+	Inc(k Key)
+	Range(f func(k Key, value float64))
+	// Delete drops the counters f returns true for and returns how many
+	Delete(f func(k Key) bool) int
+}
+
+// Counter keeps a monotonic count of matches, rate limited matches included
+type Counter struct {
+	lock   sync.Mutex
+	values map[Key]float64
+}
+
+type Options func(*Counter)
+
+// WithValues starts from the counts of the last run, so the series do not go back to zero
+func WithValues(values map[Key]float64) Options {
+	return func(c *Counter) {
+		for k, v := range values {
+			c.values[k] = v
+		}
+	}
+}
+
+func NewCounter(opt ...Options) CounterInterface {
+	c := &Counter{
+		values: make(map[Key]float64),
+	}
+	for _, o := range opt {
+		o(c)
+	}
+	return c
+}
+
+func (c *Counter) Inc(k Key) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.values[k]++
+}
+
+func (c *Counter) Range(f func(k Key, value float64)) {
+	c.lock.Lock()
+	snapshot := make(map[Key]float64, len(c.values))
+	for k, v := range c.values {
+		snapshot[k] = v
+	}
+	c.lock.Unlock()
+
+	for k, v := range snapshot {
+		f(k, v)
+	}
+}
+
+func (c *Counter) Delete(f func(k Key) bool) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	n := 0
+	for k := range c.values {
+		if f(k) {
+			delete(c.values, k)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,94 @@
+package counter
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefBuckets are seconds, the same as the prometheus client
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type HistogramKey struct {
+	AppName   string
+	FileName  string
+	RulerName string
+	Name      string
+}
+
+type HistogramValue struct {
+	// upper bounds, +Inf is implied
+	Buckets []float64
+	// cumulative count of every bucket
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+type HistogramInterface interface {
+	Observe(k HistogramKey, buckets []float64, value float64)
+	Range(f func(k HistogramKey, h HistogramValue))
+	// Delete drops the histograms f returns true for and returns how many
+	Delete(f func(k HistogramKey) bool) int
+}
+
+type Histogram struct {
+	lock   sync.Mutex
+	values map[HistogramKey]*HistogramValue
+}
+
+func NewHistogram() HistogramInterface {
+	return &Histogram{
+		values: make(map[HistogramKey]*HistogramValue),
+	}
+}
+
+// Observe takes the buckets of the first observation of k, they are sorted by the rule
+func (h *Histogram) Observe(k HistogramKey, buckets []float64, value float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	hv, ok := h.values[k]
+	if !ok {
+		hv = &HistogramValue{
+			Buckets: buckets,
+			Counts:  make([]uint64, len(buckets)),
+		}
+		h.values[k] = hv
+	}
+	for i := sort.SearchFloat64s(hv.Buckets, value); i < len(hv.Buckets); i++ {
+		hv.Counts[i]++
+	}
+	hv.Sum += value
+	hv.Count++
+}
+
+func (h *Histogram) Range(f func(k HistogramKey, h HistogramValue)) {
+	h.lock.Lock()
+	snapshot := make(map[HistogramKey]HistogramValue, len(h.values))
+	for k, v := range h.values {
+		snapshot[k] = HistogramValue{
+			Buckets: v.Buckets,
+			Counts:  append([]uint64(nil), v.Counts...),
+			Sum:     v.Sum,
+			Count:   v.Count,
+		}
+	}
+	h.lock.Unlock()
+
+	for k, v := range snapshot {
+		f(k, v)
+	}
+}
+
+func (h *Histogram) Delete(f func(k HistogramKey) bool) int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	n := 0
+	for k := range h.values {
+		if f(k) {
+			delete(h.values, k)
+			n++
+		}
+	}
+	return n
+}
@@ -1,82 +1,202 @@
 package check
 
 import (
-	"strconv"
+	"context"
 	"sync"
 	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/follow"
 )
 
+// File is what is known of a file that is or was tailed
+type File struct {
+	Name    string
+	AppName string
+	// nil once the file is no longer tailed
+	Follower follow.FollowerInterface
+	Cancel   context.CancelFunc
+	// where the last follower stopped, the next follower of the file starts there
+	Dying    int64
+	HasDying bool
+
+	touched time.Time
+}
+
+type App struct {
+	Name string
+	// the configured file path, it may be a glob
+	Pattern  string
+	KeyWords []string
+}
+
 var (
-	fileInfoMap = make(map[string]any, 30*len(conf.AppConfig.LogFile.List))
-	l           = sync.RWMutex{}
+	lock     sync.Mutex
+	files    = make(map[string]*File)
+	apps     = make(map[string]*App)
+	patterns = make(map[string]string)
 )
 
-func Insert[T any](key string, value T) {
-	l.Lock()
-	defer l.Unlock()
+func SetApp(appName, pattern string) {
+	lock.Lock()
+	defer lock.Unlock()
+	app(appName).Pattern = pattern
+	patterns[pattern] = appName
+}
 
-	fileInfoMap[key] = value
+func SetKeyWords(appName string, keyWords []string) {
+	lock.Lock()
+	defer lock.Unlock()
+	app(appName).KeyWords = keyWords
 }
 
-func KeyAppName(fileName string) string {
-	return fileName + "_appname"
+func app(appName string) *App {
+	a, ok := apps[appName]
+	if !ok {
+		a = &App{Name: appName}
+		apps[appName] = a
+	}
+	return a
 }
 
-func KeyDyingFile(fileName string) string {
-	return fileName + "_dying"
+// KeyWords of an app, false when the app is unknown, an app of field or value rules has none
+func KeyWords(appName string) ([]string, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	a, ok := apps[appName]
+	if !ok {
+		return nil, false
+	}
+	return a.KeyWords, true
 }
 
-func KeyCtx(name string) string {
-	return name + "_ctx"
+// AppOfPattern is the app a configured file path belongs to
+func AppOfPattern(pattern string) (string, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	appName, ok := patterns[pattern]
+	return appName, ok
 }
 
-func InsertWithClear[T any](key string, value T) {
-	fileInfoMap[strconv.FormatInt(time.Now().UnixNano(), 32)] = value
-	fileInfoMap[key] = value
+func file(fileName string, now time.Time) *File {
+	f, ok := files[fileName]
+	if !ok {
+		f = &File{Name: fileName}
+		files[fileName] = f
+	}
+	f.touched = now
+	return f
+}
+
+// SetAppName records the app of a file found by a scan
+func SetAppName(fileName, appName string) {
+	lock.Lock()
+	defer lock.Unlock()
+	file(fileName, time.Now()).AppName = appName
 }
-func Get(key string) any {
-	l.RLock()
-	defer l.RUnlock()
-	return fileInfoMap[key]
+
+func SetCancel(fileName string, cancel context.CancelFunc) {
+	lock.Lock()
+	defer lock.Unlock()
+	file(fileName, time.Now()).Cancel = cancel
 }
 
-func Delete(key []string) {
-	l.Lock()
-	defer l.Unlock()
-	for _, v := range key {
-		delete(fileInfoMap, v)
+func SetFollower(fileName string, follower follow.FollowerInterface) {
+	lock.Lock()
+	defer lock.Unlock()
+	file(fileName, time.Now()).Follower = follower
+}
+
+// Release drops follower once its tail is over, unless the file has another follower by now
+func Release(fileName string, follower follow.FollowerInterface) {
+	lock.Lock()
+	defer lock.Unlock()
+	if f, ok := files[fileName]; ok && f.Follower == follower {
+		f.Follower = nil
+		f.Cancel = nil
+		f.touched = time.Now()
 	}
 }
 
-func GetAndDelete(key string) any {
-	t := fileInfoMap[key]
-	l.Lock()
-	delete(fileInfoMap, key)
-	l.Unlock()
-	return t
+// Get returns a copy of the file, false when it is unknown
+func Get(fileName string) (File, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	f, ok := files[fileName]
+	if !ok {
+		return File{}, false
+	}
+	return *f, true
 }
 
-func ExpireDelete(l log.Logger) {
-	t := time.Now().UnixNano()
+// Stop cancels the tail of the file and returns a copy of it as it was, the file is
+// kept without a follower until Die records where the follower stopped
+func Stop(fileName string) (File, bool) {
+	lock.Lock()
+	f, ok := files[fileName]
+	if !ok {
+		lock.Unlock()
+		return File{}, false
+	}
+	stopped := *f
+	f.Follower = nil
+	f.Cancel = nil
+	f.touched = time.Now()
+	lock.Unlock()
 
-	for k, v := range fileInfoMap {
-		compare, err := strconv.ParseInt(k, 10, 64)
-		if err != nil {
-			level.Info(l).Log("parse conv", err, "compared number", k)
-			continue
-		}
-		if compare < t {
-			level.Info(l).Log("delete key", k, "delete value", v)
-			Delete([]string{k, v.(string)})
+	if stopped.Cancel != nil {
+		stopped.Cancel()
+	}
+	return stopped, true
+}
+
+// Die records the offset the follower of a file stopped at
+func Die(fileName string, offset int64) {
+	lock.Lock()
+	defer lock.Unlock()
+	f := file(fileName, time.Now())
+	f.Dying = offset
+	f.HasDying = true
+}
+
+// TakeDying returns the offset recorded by Die once
+func TakeDying(fileName string) (int64, bool) {
+	lock.Lock()
+	defer lock.Unlock()
+	f, ok := files[fileName]
+	if !ok || !f.HasDying {
+		return 0, false
+	}
+	f.HasDying = false
+	return f.Dying, true
+}
+
+// Range calls f with a copy of every file that is tailed, f may call the other functions of check
+func Range(f func(v File)) {
+	lock.Lock()
+	tailed := make([]File, 0, len(files))
+	for _, v := range files {
+		if v.Follower != nil {
+			tailed = append(tailed, *v)
 		}
 	}
+	lock.Unlock()
+
+	for _, v := range tailed {
+		f(v)
+	}
 }
-func Range(f func(k string, v any)) {
-	for k, v := range fileInfoMap {
-		f(k, v)
+
+// Expire forgets the files that are not tailed and were not touched within ttl
+func Expire(l log.Logger, ttl time.Duration) {
+	lock.Lock()
+	defer lock.Unlock()
+	deadline := time.Now().Add(-ttl)
+	for k, v := range files {
+		if v.Follower == nil && v.Cancel == nil && v.touched.Before(deadline) {
+			level.Info(l).Log("delete file", k, "appname", v.AppName, "dying offset", v.Dying)
+			delete(files, k)
+		}
 	}
 }
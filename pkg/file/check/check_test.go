@@ -0,0 +1,156 @@
+package check
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/follow"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/identity"
+)
+
+type fakeFollower struct {
+	name string
+	told atomic.Int64
+}
+
+func (f *fakeFollower) Filename() string                     { return f.name }
+func (f *fakeFollower) Lines() <-chan *follow.Line           { return nil }
+func (f *fakeFollower) Tell() (int64, error)                 { return f.told.Add(1), nil }
+func (f *fakeFollower) Identity() (identity.Identity, error) { return identity.Identity{}, nil }
+func (f *fakeFollower) Stop() error                          { return nil }
+
+func TestKeyWordsOfAppWithoutKeyWords(t *testing.T) {
+	SetApp("fields-only", "/tmp/fields-only.log")
+	SetKeyWords("fields-only", nil)
+	if _, ok := KeyWords("fields-only"); !ok {
+		t.Fatal("an app without keywords is unknown")
+	}
+	if _, ok := KeyWords("not-configured"); ok {
+		t.Fatal("an app that is not configured is known")
+	}
+	if app, ok := AppOfPattern("/tmp/fields-only.log"); !ok || app != "fields-only" {
+		t.Fatalf("app of pattern is %q", app)
+	}
+}
+
+func TestStopDie(t *testing.T) {
+	name := "/tmp/stop-die.log"
+	cancelled := false
+	SetAppName(name, "app")
+	SetCancel(name, func() { cancelled = true })
+	f := &fakeFollower{name: name}
+	SetFollower(name, f)
+
+	stopped, ok := Stop(name)
+	if !ok || stopped.Follower != f || stopped.AppName != "app" || !cancelled {
+		t.Fatalf("stopped %+v, cancelled %v", stopped, cancelled)
+	}
+	if v, _ := Get(name); v.Follower != nil || v.Cancel != nil {
+		t.Fatalf("stopped file still tailed %+v", v)
+	}
+	// the tail ending after Stop leaves the file alone
+	Release(name, f)
+
+	Die(name, 42)
+	if offset, ok := TakeDying(name); !ok || offset != 42 {
+		t.Fatalf("dying offset %d %v", offset, ok)
+	}
+	if _, ok := TakeDying(name); ok {
+		t.Fatal("dying offset taken twice")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	tailed, idle := "/tmp/expire-tailed.log", "/tmp/expire-idle.log"
+	SetFollower(tailed, &fakeFollower{name: tailed})
+	SetAppName(idle, "app")
+
+	Expire(log.NewNopLogger(), time.Hour)
+	if _, ok := Get(idle); !ok {
+		t.Fatal("file expired before its ttl")
+	}
+	time.Sleep(time.Millisecond)
+	Expire(log.NewNopLogger(), 0)
+	if _, ok := Get(idle); ok {
+		t.Fatal("idle file not expired")
+	}
+	if _, ok := Get(tailed); !ok {
+		t.Fatal("tailed file expired")
+	}
+	Release(tailed, nil)
+	if v, _ := Get(tailed); v.Follower == nil {
+		t.Fatal("released by another follower")
+	}
+}
+
+// run with -race, a reload stops and starts tails while the positions are saved
+func TestConcurrentReloadAndSave(t *testing.T) {
+	const n = 20
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("/tmp/race-%d.log", i)
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// reload
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			name := names[i%n]
+			TakeDying(name)
+			SetAppName(name, "app")
+			SetCancel(name, func() {})
+			if v, ok := Stop(names[(i+n/2)%n]); ok && v.Follower != nil {
+				offset, _ := v.Follower.Tell()
+				Die(v.Name, offset)
+			}
+		}
+		close(done)
+	}()
+
+	// tails
+	for i := 0; i < n; i++ {
+		name := names[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				f := &fakeFollower{name: name}
+				SetFollower(name, f)
+				Release(name, f)
+			}
+		}()
+	}
+
+	// save
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			Range(func(v File) {
+				if _, err := v.Follower.Tell(); err != nil {
+					t.Error(err)
+				}
+				KeyWords(v.AppName)
+			})
+			Expire(log.NewNopLogger(), time.Millisecond)
+		}
+	}()
+	wg.Wait()
+}
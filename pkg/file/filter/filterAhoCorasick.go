@@ -0,0 +1,188 @@
+package filter
+
+import "sort"
+
+// AhoCorasickThreshold is the keyword count from which the default match type
+// scans each line once with an automaton instead of calling strings.Contains per keyword
+const AhoCorasickThreshold = 32
+
+// acList is a keyword list given to NewAhoCorasickFilter, HaveFilterList puts the
+// patterns found in list order without looking each keyword up
+type acList struct {
+	keyWords []string
+	// positions in the list of every pattern, and of the empty keywords
+	positions map[int32][]int
+	empty     []int
+}
+
+type AhoCorasickFilter struct {
+	// bytes found in no pattern share class 0
+	class   [256]int32
+	classes int32
+	// delta[state*classes+class] is the next state, every state has every transition
+	delta []int32
+	// indexes of the patterns ending in a state, including the ones reached through fail links
+	out      [][]int32
+	patterns map[string]int32
+	lists    []acList
+}
+
+func NewAhoCorasickFilter(patterns ...[]string) HaveFilterInterface[string] {
+	af := &AhoCorasickFilter{
+		classes:  1,
+		patterns: make(map[string]int32),
+	}
+	for _, list := range patterns {
+		for _, v := range list {
+			for i := 0; i < len(v); i++ {
+				if af.class[v[i]] == 0 {
+					af.class[v[i]] = af.classes
+					af.classes++
+				}
+			}
+		}
+	}
+	af.newState()
+	for _, list := range patterns {
+		l := acList{keyWords: list, positions: make(map[int32][]int)}
+		for i, v := range list {
+			if v == "" {
+				l.empty = append(l.empty, i)
+				continue
+			}
+			index, ok := af.patterns[v]
+			if !ok {
+				index = int32(len(af.patterns))
+				af.patterns[v] = index
+				af.insert(v, index)
+			}
+			l.positions[index] = append(l.positions[index], i)
+		}
+		af.lists = append(af.lists, l)
+	}
+	af.build()
+	return af
+}
+
+func (af *AhoCorasickFilter) newState() int32 {
+	state := int32(len(af.out))
+	af.out = append(af.out, nil)
+	for i := int32(0); i < af.classes; i++ {
+		af.delta = append(af.delta, -1)
+	}
+	return state
+}
+
+func (af *AhoCorasickFilter) insert(word string, index int32) {
+	cur := int32(0)
+	for i := 0; i < len(word); i++ {
+		t := cur*af.classes + af.class[word[i]]
+		if af.delta[t] < 0 {
+			af.delta[t] = af.newState()
+		}
+		cur = af.delta[t]
+	}
+	af.out[cur] = append(af.out[cur], index)
+}
+
+// build turns the trie into the automaton, a missing transition goes where the fail link of the state goes
+func (af *AhoCorasickFilter) build() {
+	fail := make([]int32, len(af.out))
+	queue := make([]int32, 0, len(af.out))
+	for c := int32(0); c < af.classes; c++ {
+		if n := af.delta[c]; n > 0 {
+			queue = append(queue, n)
+		} else {
+			af.delta[c] = 0
+		}
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for c := int32(0); c < af.classes; c++ {
+			t := cur*af.classes + c
+			n := af.delta[t]
+			if n < 0 {
+				af.delta[t] = af.delta[fail[cur]*af.classes+c]
+				continue
+			}
+			fail[n] = af.delta[fail[cur]*af.classes+c]
+			af.out[n] = append(af.out[n], af.out[fail[n]]...)
+			queue = append(queue, n)
+		}
+	}
+}
+
+// scan walks msg once and reports every pattern index found, an index may be reported more than once
+func (af *AhoCorasickFilter) scan(msg string, found func(index int32)) {
+	cur := int32(0)
+	for i := 0; i < len(msg); i++ {
+		cur = af.delta[cur*af.classes+af.class[msg[i]]]
+		for _, o := range af.out[cur] {
+			found(o)
+		}
+	}
+}
+
+// hits are the indexes of the patterns found in msg, each once
+func (af *AhoCorasickFilter) hits(msg string) []int32 {
+	var hits []int32
+	af.scan(msg, func(index int32) {
+		for _, v := range hits {
+			if v == index {
+				return
+			}
+		}
+		hits = append(hits, index)
+	})
+	return hits
+}
+
+// HaveFilterList returns the keywords of the list-th list given to NewAhoCorasickFilter found in msg
+func (af *AhoCorasickFilter) HaveFilterList(msg string, list int) []string {
+	if list < 0 || list >= len(af.lists) {
+		return nil
+	}
+	l := &af.lists[list]
+	// keep the keyword order of the config, same as DefaultFilter
+	positions := append([]int(nil), l.empty...)
+	for _, v := range af.hits(msg) {
+		positions = append(positions, l.positions[v]...)
+	}
+	if len(positions) == 0 {
+		return nil
+	}
+	sort.Ints(positions)
+	found := make([]string, len(positions))
+	for i, v := range positions {
+		found[i] = l.keyWords[v]
+	}
+	return found
+}
+
+// HaveFilter looks every keyword up, HaveFilterList is faster for a list the filter was built with
+func (af *AhoCorasickFilter) HaveFilter(msg string, keyWord []string) []string {
+	hits := af.hits(msg)
+	var found []string
+	for _, v := range keyWord {
+		// strings.Contains finds an empty keyword in every line
+		if v == "" {
+			found = append(found, v)
+			continue
+		}
+		if len(hits) == 0 {
+			continue
+		}
+		index, ok := af.patterns[v]
+		if !ok {
+			continue
+		}
+		for _, h := range hits {
+			if h == index {
+				found = append(found, v)
+				break
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,94 @@
+package filter
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func keyWords(n int) []string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("ERR%04d", i)
+	}
+	return words
+}
+
+func TestAhoCorasickSameAsDefault(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	// a small alphabet makes keywords overlap and nest in each other
+	word := func(max int) string {
+		b := make([]byte, r.Intn(max)+1)
+		for i := range b {
+			b[i] = "abc "[r.Intn(4)]
+		}
+		return string(b)
+	}
+	df := NewFilter(DefaultFilter{})
+	for i := 0; i < 2000; i++ {
+		words := make([]string, r.Intn(40))
+		for j := range words {
+			words[j] = word(5)
+		}
+		// an empty keyword and repeated ones
+		if i%10 == 0 {
+			words = append(words, "")
+			words = append(words, words[:r.Intn(len(words))]...)
+		}
+		exclude := []string{word(3), word(3)}
+		af := NewAhoCorasickFilter(words, exclude).(*AhoCorasickFilter)
+		for j := 0; j < 20; j++ {
+			msg := word(60)
+			want := df.HaveFilter(msg, words)
+			// the list the filter was built with, and looked up keyword by keyword
+			if got := af.HaveFilterList(msg, ListKeyWords); !reflect.DeepEqual(want, got) {
+				t.Fatalf("keywords %q in %q: default found %q, aho-corasick list found %q", words, msg, want, got)
+			}
+			if got := af.HaveFilter(msg, words); !reflect.DeepEqual(want, got) {
+				t.Fatalf("keywords %q in %q: default found %q, aho-corasick found %q", words, msg, want, got)
+			}
+			want = df.HaveFilter(msg, exclude)
+			if got := af.HaveFilterList(msg, ListExclude); !reflect.DeepEqual(want, got) {
+				t.Fatalf("exclude %q in %q: default found %q, aho-corasick list found %q", exclude, msg, want, got)
+			}
+		}
+		if got := af.HaveFilterList("abc", ListResolve); got != nil {
+			t.Fatalf("list that was not given found %q", got)
+		}
+	}
+}
+
+func TestNewHaveFilterThreshold(t *testing.T) {
+	for n, want := range map[int]string{AhoCorasickThreshold - 1: "*filter.DefaultFilter", AhoCorasickThreshold: "*filter.AhoCorasickFilter"} {
+		hf, err := NewHaveFilter(MatchTypeDefault, keyWords(n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%T", hf); got != want {
+			t.Errorf("%d keywords use %s, want %s", n, got, want)
+		}
+	}
+}
+
+func BenchmarkHaveFilter(b *testing.B) {
+	line := "2026-10-18 10:12:01.123 INFO [worker-7] order 8812 paid by user 1290, took 132ms " +
+		strings.Repeat("payload ", 20) + "ERR0009 retried"
+	for _, n := range []int{10, 32, 100, 500} {
+		words := keyWords(n)
+		df := NewFilter(DefaultFilter{})
+		b.Run(fmt.Sprintf("DefaultFilter/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				df.HaveFilter(line, words)
+			}
+		})
+		// the pipeline asks by list
+		af := NewAhoCorasickFilter(words).(ListFilterInterface)
+		b.Run(fmt.Sprintf("AhoCorasickFilter/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				af.HaveFilterList(line, ListKeyWords)
+			}
+		})
+	}
+}
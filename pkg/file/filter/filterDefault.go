@@ -11,15 +11,12 @@ func NewFilter(df DefaultFilter) HaveFilterInterface[string] {
 	return &df
 }
 
-func (df *DefaultFilter) HaveFilter(msg string, keyWord []string) *string {
-	check := false
+func (df *DefaultFilter) HaveFilter(msg string, keyWord []string) []string {
+	var found []string
 	for _, v := range keyWord {
-		v := v
-		check = strings.Contains(msg, v)
-		if check {
-
-			return &v
+		if strings.Contains(msg, v) {
+			found = append(found, v)
 		}
 	}
-	return nil
+	return found
 }
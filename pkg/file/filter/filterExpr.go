@@ -0,0 +1,276 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExprFilter treats every keyword as a boolean expression over terms, e.g.
+// ("timeout" AND "payment") AND NOT "retry succeeded".
+// NOT binds tighter than AND, AND binds tighter than OR, a term matches when the line contains it.
+// The keywords other than the ones given as expressions, like the exclude list, are plain text.
+type ExprFilter struct {
+	exprs map[string]exprNode
+}
+
+type SyntaxError struct {
+	Expr string
+	// 1-based position in Expr
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("expression %q: %s at position %d", e.Expr, e.Msg, e.Pos)
+}
+
+func NewExprFilter(keyWords []string) (HaveFilterInterface[string], error) {
+	ef := &ExprFilter{
+		exprs: make(map[string]exprNode, len(keyWords)),
+	}
+	for _, v := range keyWords {
+		if _, ok := ef.exprs[v]; ok {
+			continue
+		}
+		node, err := parseExpr(v)
+		if err != nil {
+			return nil, err
+		}
+		ef.exprs[v] = node
+	}
+	return ef, nil
+}
+
+func (ef *ExprFilter) HaveFilter(msg string, keyWord []string) []string {
+	var found []string
+	for _, v := range keyWord {
+		node, ok := ef.exprs[v]
+		if ok && node.eval(msg) || !ok && strings.Contains(msg, v) {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+type exprNode interface {
+	eval(msg string) bool
+}
+
+type termNode struct {
+	word string
+}
+
+func (n *termNode) eval(msg string) bool {
+	return strings.Contains(msg, n.word)
+}
+
+type notNode struct {
+	x exprNode
+}
+
+func (n *notNode) eval(msg string) bool {
+	return !n.x.eval(msg)
+}
+
+type andNode struct {
+	left, right exprNode
+}
+
+func (n *andNode) eval(msg string) bool {
+	return n.left.eval(msg) && n.right.eval(msg)
+}
+
+type orNode struct {
+	left, right exprNode
+}
+
+func (n *orNode) eval(msg string) bool {
+	return n.left.eval(msg) || n.right.eval(msg)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenTerm
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func lexExpr(src string) ([]token, error) {
+	tokens := make([]token, 0, 8)
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(src) {
+				if src[i] == '\\' && i+1 < len(src) {
+					sb.WriteByte(src[i+1])
+					i += 2
+					continue
+				}
+				if src[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			if !closed {
+				return nil, &SyntaxError{Expr: src, Pos: start + 1, Msg: "unterminated string"}
+			}
+			if sb.Len() == 0 {
+				return nil, &SyntaxError{Expr: src, Pos: start + 1, Msg: "empty term"}
+			}
+			tokens = append(tokens, token{kind: tokenTerm, text: sb.String(), pos: start})
+		default:
+			start := i
+			for i < len(src) && !strings.ContainsRune(" \t\r\n()\"", rune(src[i])) {
+				i++
+			}
+			word := src[start:i]
+			kind := tokenTerm
+			switch strings.ToUpper(word) {
+			case "AND":
+				kind = tokenAnd
+			case "OR":
+				kind = tokenOr
+			case "NOT":
+				kind = tokenNot
+			}
+			tokens = append(tokens, token{kind: kind, text: word, pos: start})
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+type exprParser struct {
+	src    string
+	tokens []token
+	cur    int
+}
+
+func parseExpr(src string) (exprNode, error) {
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{src: src, tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return node, nil
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.cur]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.cur]
+	if t.kind != tokenEOF {
+		p.cur++
+	}
+	return t
+}
+
+func (p *exprParser) errorf(t token, format string, args ...any) error {
+	return &SyntaxError{Expr: p.src, Pos: t.pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.peek().kind == tokenNot {
+		p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenTerm:
+		return &termNode{word: t.text}, nil
+	case tokenLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.errorf(closing, "expected \")\" but got %s", closing)
+		}
+		return node, nil
+	default:
+		return nil, p.errorf(t, "expected term or \"(\" but got %s", t)
+	}
+}
@@ -0,0 +1,102 @@
+package filter
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExprEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		msg  string
+		want bool
+	}{
+		// NOT binds tighter than AND, AND tighter than OR
+		{`a OR b AND c`, "a", true},
+		{`a OR b AND c`, "b", false},
+		{`a OR b AND c`, "b c", true},
+		{`(a OR b) AND c`, "a", false},
+		{`(a OR b) AND c`, "a c", true},
+		{`NOT a AND b`, "b", true},
+		{`NOT a AND b`, "a b", false},
+		{`NOT (a AND b)`, "a", true},
+		{`NOT (a AND b)`, "a b", false},
+		{`NOT NOT a`, "a", true},
+		{`a AND b OR c AND d`, "c d", true},
+		{`a AND b OR c AND d`, "a d", false},
+		{`((a))`, "a", true},
+		// operators are case insensitive, a quoted operator is a term
+		{`a and not b`, "a", true},
+		{`"AND" or "OR"`, "x OR y", true},
+		{`"AND" or "OR"`, "x y", false},
+		// quotes keep spaces and parentheses, a backslash escapes a quote
+		{`"payment timeout" AND NOT "retry (2)"`, "payment timeout", true},
+		{`"payment timeout" AND NOT "retry (2)"`, "payment timeout retry (2)", false},
+		{`"payment timeout"`, "payment failed timeout", false},
+		{`"say \"hi\""`, `they say "hi"`, true},
+	}
+	for _, v := range tests {
+		node, err := parseExpr(v.expr)
+		if err != nil {
+			t.Fatalf("parse %s: %v", v.expr, err)
+		}
+		if got := node.eval(v.msg); got != v.want {
+			t.Errorf("%s on %q is %v, want %v", v.expr, v.msg, got, v.want)
+		}
+	}
+}
+
+func TestExprSyntaxError(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+		msg  string
+	}{
+		{`a AND`, 6, `expected term or "(" but got end of expression`},
+		{`AND a`, 1, `expected term or "(" but got "AND"`},
+		{`(a OR b`, 8, `expected ")" but got end of expression`},
+		{`a b`, 3, `unexpected "b"`},
+		{`a)`, 2, `unexpected ")"`},
+		{`a AND "b`, 7, `unterminated string`},
+		{`a OR ""`, 6, `empty term`},
+		{`NOT`, 4, `expected term or "(" but got end of expression`},
+		{``, 1, `expected term or "(" but got end of expression`},
+	}
+	for _, v := range tests {
+		_, err := parseExpr(v.expr)
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Fatalf("%s: err %v, want a syntax error", v.expr, err)
+		}
+		if se.Pos != v.pos || se.Msg != v.msg {
+			t.Errorf("%s: %q at %d, want %q at %d", v.expr, se.Msg, se.Pos, v.msg, v.pos)
+		}
+	}
+}
+
+func TestExprFilterPlainExclude(t *testing.T) {
+	keyWords := []string{`error AND NOT debug`, `timeout OR refused`}
+	exclude := []string{"no error found", "(expected)"}
+	hf, err := NewHaveFilter(MatchTypeExpr, keyWords, exclude, []string{"recovered"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := "connection refused, no error found"
+	if got := hf.HaveFilter(msg, keyWords); !reflect.DeepEqual(got, []string{`error AND NOT debug`, `timeout OR refused`}) {
+		t.Fatalf("keywords %v", got)
+	}
+	if got := hf.HaveFilter(msg, exclude); !reflect.DeepEqual(got, []string{"no error found"}) {
+		t.Fatalf("exclude %v", got)
+	}
+	if got := hf.HaveFilter("error (expected)", exclude); !reflect.DeepEqual(got, []string{"(expected)"}) {
+		t.Fatalf("exclude %v", got)
+	}
+	if got := hf.HaveFilter("error debug", keyWords); len(got) != 0 {
+		t.Fatalf("keywords %v", got)
+	}
+
+	if _, err := NewHaveFilter(MatchTypeExpr, []string{"error AND"}); err == nil {
+		t.Fatal("a keyword that is no expression is accepted")
+	}
+}
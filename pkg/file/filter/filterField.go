@@ -0,0 +1,94 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+)
+
+const (
+	FieldOpEqual    = "=="
+	FieldOpNotEqual = "!="
+	FieldOpContains = "contains"
+	FieldOpRegex    = "=~"
+	FieldOpExists   = "exists"
+)
+
+type fieldCond struct {
+	field string
+	op    string
+	value string
+	reg   *regexp.Regexp
+}
+
+// FieldFilter matches the fields a parser took from a line, every condition has to hold
+type FieldFilter struct {
+	conds []fieldCond
+	desc  string
+}
+
+func NewFieldFilter(rules []conf.FieldRule) (*FieldFilter, error) {
+	ff := &FieldFilter{
+		conds: make([]fieldCond, 0, len(rules)),
+	}
+	desc := make([]string, 0, len(rules))
+	for _, v := range rules {
+		if v.Field == "" {
+			return nil, fmt.Errorf("field rule %+v has no field", v)
+		}
+		cond := fieldCond{field: v.Field, op: v.Op, value: v.Value}
+		switch v.Op {
+		case "", "eq":
+			cond.op = FieldOpEqual
+		case "ne":
+			cond.op = FieldOpNotEqual
+		case "regex":
+			cond.op = FieldOpRegex
+		case FieldOpEqual, FieldOpNotEqual, FieldOpContains, FieldOpRegex, FieldOpExists:
+		default:
+			return nil, fmt.Errorf("unknown op %q of field %q", v.Op, v.Field)
+		}
+		if cond.op == FieldOpRegex {
+			reg, err := regexp.Compile(v.Value)
+			if err != nil {
+				return nil, fmt.Errorf("compile regex %q of field %q failed: %w", v.Value, v.Field, err)
+			}
+			cond.reg = reg
+		}
+		ff.conds = append(ff.conds, cond)
+		if cond.op == FieldOpExists {
+			desc = append(desc, cond.field+" exists")
+		} else {
+			desc = append(desc, fmt.Sprintf("%s %s %q", cond.field, cond.op, cond.value))
+		}
+	}
+	ff.desc = strings.Join(desc, " AND ")
+	return ff, nil
+}
+
+func (ff *FieldFilter) Match(fields map[string]string) bool {
+	for _, c := range ff.conds {
+		value, ok := fields[c.field]
+		switch c.op {
+		case FieldOpEqual:
+			ok = ok && value == c.value
+		case FieldOpNotEqual:
+			ok = !ok || value != c.value
+		case FieldOpContains:
+			ok = ok && strings.Contains(value, c.value)
+		case FieldOpRegex:
+			ok = ok && c.reg.MatchString(value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String is used as the keywords label when a rule has only field conditions
+func (ff *FieldFilter) String() string {
+	return ff.desc
+}
@@ -1,5 +1,57 @@
 package filter
 
+import "fmt"
+
+const (
+	MatchTypeDefault = "default"
+	MatchTypeRegex   = "regex"
+	MatchTypeExpr    = "expr"
+)
+
 type HaveFilterInterface[T any] interface {
-	HaveFilter(msg T, keyWord []T) *string
+	// HaveFilter returns every keyword found in msg, in the order of keyWord
+	HaveFilter(msg T, keyWord []T) []string
+}
+
+// the keyword lists given to NewHaveFilter, in order
+const (
+	ListKeyWords = iota
+	ListExclude
+	ListResolve
+)
+
+// ListFilterInterface is implemented by the filters that keep the lists they were built with,
+// list is the index of the list in the patterns of NewHaveFilter
+type ListFilterInterface interface {
+	HaveFilterList(msg string, list int) []string
+}
+
+// CaptureFilterInterface is implemented by the filters able to take named groups out of a matched keyword
+type CaptureFilterInterface interface {
+	Captures(msg string, keyWord string) map[string]string
+}
+
+// NewHaveFilter picks the filter by matchType, patterns are every keyword list the filter will be asked about,
+// the keywords, the exclude keywords and the resolve keywords, only the keywords are expressions under expr
+func NewHaveFilter(matchType string, patterns ...[]string) (HaveFilterInterface[string], error) {
+	switch matchType {
+	case "", MatchTypeDefault:
+		total := 0
+		for _, v := range patterns {
+			total += len(v)
+		}
+		if total >= AhoCorasickThreshold {
+			return NewAhoCorasickFilter(patterns...), nil
+		}
+		return NewFilter(DefaultFilter{}), nil
+	case MatchTypeRegex:
+		return NewRegexFilter(patterns...)
+	case MatchTypeExpr:
+		if len(patterns) == 0 {
+			return NewExprFilter(nil)
+		}
+		return NewExprFilter(patterns[0])
+	default:
+		return nil, fmt.Errorf("unknown match type %q", matchType)
+	}
 }
@@ -0,0 +1,62 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+)
+
+type RegexFilter struct {
+	regs map[string]*regexp.Regexp
+}
+
+// NewRegexFilter compiles every pattern once, the same pattern may appear in several lists
+func NewRegexFilter(patterns ...[]string) (HaveFilterInterface[string], error) {
+	rf := &RegexFilter{
+		regs: make(map[string]*regexp.Regexp),
+	}
+	for _, list := range patterns {
+		for _, v := range list {
+			if _, ok := rf.regs[v]; ok {
+				continue
+			}
+			reg, err := regexp.Compile(v)
+			if err != nil {
+				return nil, fmt.Errorf("compile regex %q failed: %w", v, err)
+			}
+			rf.regs[v] = reg
+		}
+	}
+	return rf, nil
+}
+
+func (rf *RegexFilter) HaveFilter(msg string, keyWord []string) []string {
+	var found []string
+	for _, v := range keyWord {
+		reg, ok := rf.regs[v]
+		if !ok {
+			continue
+		}
+		if reg.MatchString(msg) {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+func (rf *RegexFilter) Captures(msg string, keyWord string) map[string]string {
+	reg, ok := rf.regs[keyWord]
+	if !ok || reg.NumSubexp() == 0 {
+		return nil
+	}
+	sub := reg.FindStringSubmatch(msg)
+	if sub == nil {
+		return nil
+	}
+	captures := make(map[string]string, reg.NumSubexp())
+	for i, name := range reg.SubexpNames() {
+		if name != "" && sub[i] != "" {
+			captures[name] = sub[i]
+		}
+	}
+	return captures
+}
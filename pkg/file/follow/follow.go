@@ -0,0 +1,394 @@
+package follow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/identity"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/metrics"
+)
+
+const (
+	RotationRename   = "rename"
+	RotationTruncate = "truncate"
+	RotationRemove   = "remove"
+
+	defaultPoll = time.Millisecond * 250
+	// bytes kept of what was read last, to find a truncation the file grew back from
+	tailSize = 64
+)
+
+type Line struct {
+	Text string
+	// where the line starts in the file
+	Offset int64
+	Time   time.Time
+}
+
+type FollowerInterface interface {
+	Filename() string
+	// Lines is closed once the follower stops
+	Lines() <-chan *Line
+	// Tell is where the line after the last one taken from Lines starts
+	Tell() (int64, error)
+	// Identity of the file read now
+	Identity() (identity.Identity, error)
+	Stop() error
+}
+
+// Follower reads the lines appended to a file, it follows the name of the file through
+// rename rotation, reading what is left in the renamed file first, and through copytruncate
+type Follower struct {
+	fileName  string
+	offset    int64
+	whence    int
+	follow    bool
+	reOpen    bool
+	mustExist bool
+	poll      time.Duration
+	l         log.Logger
+
+	lines  chan *Line
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+
+	// guards file, which Identity reads from another goroutine
+	lock   sync.Mutex
+	file   *os.File
+	info   os.FileInfo
+	reader *bufio.Reader
+	// next byte of file to read, the start of a partial line read before is kept in pending
+	readAt  int64
+	pending string
+	// the bytes of the file right before readAt
+	tail []byte
+	// the offset of the line after the last one taken from lines
+	told atomic.Int64
+}
+
+type Options func(*Follower)
+
+// WithLocation starts reading at offset from whence, like io.Seeker
+func WithLocation(offset int64, whence int) Options {
+	return func(f *Follower) {
+		f.offset = offset
+		f.whence = whence
+	}
+}
+
+// WithFollow keeps waiting for lines at the end of the file instead of stopping
+func WithFollow(follow bool) Options {
+	return func(f *Follower) {
+		f.follow = follow
+	}
+}
+
+// WithReOpen opens the file again once it is renamed or removed and created again
+func WithReOpen(reOpen bool) Options {
+	return func(f *Follower) {
+		f.reOpen = reOpen
+	}
+}
+
+// WithMustExist fails NewFollower when the file does not exist yet
+func WithMustExist(mustExist bool) Options {
+	return func(f *Follower) {
+		f.mustExist = mustExist
+	}
+}
+
+func WithPoll(poll time.Duration) Options {
+	return func(f *Follower) {
+		f.poll = poll
+	}
+}
+
+func WithLog(l log.Logger) Options {
+	return func(f *Follower) {
+		f.l = l
+	}
+}
+
+func NewFollower(fileName string, opt ...Options) (FollowerInterface, error) {
+	f := &Follower{
+		fileName: fileName,
+		poll:     defaultPoll,
+		l:        log.NewNopLogger(),
+		lines:    make(chan *Line),
+		done:     make(chan struct{}),
+	}
+	for _, o := range opt {
+		o(f)
+	}
+	if f.mustExist {
+		if _, err := os.Stat(fileName); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
+	go f.run(ctx)
+	return f, nil
+}
+
+func (f *Follower) Filename() string {
+	return f.fileName
+}
+
+func (f *Follower) Lines() <-chan *Line {
+	return f.lines
+}
+
+func (f *Follower) Tell() (int64, error) {
+	return f.told.Load(), nil
+}
+
+func (f *Follower) Identity() (identity.Identity, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file == nil {
+		return identity.Identity{}, os.ErrNotExist
+	}
+	return identity.OfFile(f.file)
+}
+
+func (f *Follower) Stop() error {
+	f.cancel()
+	<-f.done
+	return f.err
+}
+
+func (f *Follower) run(ctx context.Context) {
+	defer close(f.done)
+	defer close(f.lines)
+	defer f.closeFile()
+
+	if err := f.open(ctx, true); err != nil {
+		if !errors.Is(err, context.Canceled) {
+			f.err = err
+			level.Error(f.l).Log("open followed file failed, filename", f.fileName, "err", err)
+		}
+		return
+	}
+	for {
+		line, err := f.reader.ReadString('\n')
+		if err == nil {
+			start := f.readAt - int64(len(f.pending))
+			f.readAt += int64(len(line))
+			f.keepTail(line)
+			text := strings.TrimRight(f.pending+line, "\n")
+			f.pending = ""
+			if !f.send(ctx, &Line{Text: text, Offset: start, Time: time.Now()}, f.readAt) {
+				return
+			}
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			f.err = err
+			level.Error(f.l).Log("read followed file failed, filename", f.fileName, "err", err)
+			return
+		}
+		f.readAt += int64(len(line))
+		f.keepTail(line)
+		f.pending += line
+		if !f.follow {
+			if f.pending != "" {
+				f.send(ctx, &Line{Text: f.pending, Offset: f.readAt - int64(len(f.pending)), Time: time.Now()}, f.readAt)
+			}
+			return
+		}
+		if err := f.wait(ctx); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				f.err = err
+				level.Error(f.l).Log("follow file failed, filename", f.fileName, "err", err)
+			}
+			return
+		}
+	}
+}
+
+func (f *Follower) send(ctx context.Context, line *Line, next int64) bool {
+	select {
+	case f.lines <- line:
+		f.told.Store(next)
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// wait returns once there is more to read at the end of the file, it switches to the new
+// file after a rename and goes back to the start after a truncation
+func (f *Follower) wait(ctx context.Context) error {
+	t := time.NewTicker(f.poll)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		// what was written to the old file right before it was renamed is read first
+		cur, err := f.file.Stat()
+		if err != nil {
+			return err
+		}
+		if f.truncated(cur.Size()) {
+			level.Info(f.l).Log("followed file truncated, filename", f.fileName, "size", cur.Size(), "read", f.readAt)
+			metrics.FileRotations.WithLabelValues(f.fileName, RotationTruncate).Inc()
+			f.flushPending(ctx)
+			return f.seek(0)
+		}
+		if cur.Size() > f.readAt {
+			return nil
+		}
+
+		info, err := os.Stat(f.fileName)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			if f.info != nil {
+				level.Info(f.l).Log("followed file removed, filename", f.fileName)
+				metrics.FileRotations.WithLabelValues(f.fileName, RotationRemove).Inc()
+				f.info = nil
+			}
+			if !f.reOpen {
+				return err
+			}
+			continue
+		case err != nil:
+			return err
+		case f.info == nil || !os.SameFile(cur, info):
+			if f.info != nil {
+				level.Info(f.l).Log("followed file renamed, filename", f.fileName, "read", f.readAt)
+				metrics.FileRotations.WithLabelValues(f.fileName, RotationRename).Inc()
+			}
+			if !f.reOpen {
+				return fmt.Errorf("%s is rotated", f.fileName)
+			}
+			f.flushPending(ctx)
+			f.closeFile()
+			return f.open(ctx, false)
+		}
+	}
+}
+
+// truncated tells a truncation from the file growing, the bytes before readAt change
+// even when the file is written past readAt again before the next poll
+func (f *Follower) truncated(size int64) bool {
+	if size < f.readAt {
+		return true
+	}
+	if len(f.tail) == 0 {
+		return false
+	}
+	buf := make([]byte, len(f.tail))
+	if _, err := f.file.ReadAt(buf, f.readAt-int64(len(buf))); err != nil {
+		return true
+	}
+	return !bytes.Equal(buf, f.tail)
+}
+
+func (f *Follower) keepTail(read string) {
+	f.tail = append(f.tail, read...)
+	if n := len(f.tail) - tailSize; n > 0 {
+		f.tail = f.tail[:copy(f.tail, f.tail[n:])]
+	}
+}
+
+// flushPending sends the last line of a file that will not be written to any more
+func (f *Follower) flushPending(ctx context.Context) {
+	if f.pending == "" {
+		return
+	}
+	text := f.pending
+	f.pending = ""
+	f.send(ctx, &Line{Text: text, Offset: f.readAt - int64(len(text)), Time: time.Now()}, f.readAt)
+}
+
+// open waits for the file to exist when reOpen is set, the configured location only applies to the first open
+func (f *Follower) open(ctx context.Context, first bool) error {
+	t := time.NewTicker(f.poll)
+	defer t.Stop()
+	for {
+		file, err := os.Open(f.fileName)
+		if err == nil {
+			info, err := file.Stat()
+			if err != nil {
+				file.Close()
+				return err
+			}
+			// Identity waits until Tell is of the new file
+			f.lock.Lock()
+			defer f.lock.Unlock()
+			f.file = file
+			f.info = info
+			break
+		}
+		if !errors.Is(err, os.ErrNotExist) || !f.reOpen {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	if !first {
+		return f.seek(0)
+	}
+	offset, err := f.file.Seek(f.offset, f.whence)
+	if err != nil {
+		return err
+	}
+	// the file was truncated while nobody followed it
+	if offset > f.info.Size() {
+		level.Info(f.l).Log("offset is past the end, read from start, filename", f.fileName, "offset", offset, "size", f.info.Size())
+		return f.seek(0)
+	}
+	f.readAt = offset
+	f.reader = bufio.NewReader(f.file)
+	f.told.Store(offset)
+	// what was read before the start
+	n := int64(tailSize)
+	if offset < n {
+		n = offset
+	}
+	f.tail = make([]byte, n)
+	if _, err := f.file.ReadAt(f.tail, offset-n); err != nil {
+		f.tail = nil
+	}
+	return nil
+}
+
+func (f *Follower) seek(offset int64) error {
+	if _, err := f.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	f.readAt = offset
+	f.pending = ""
+	f.tail = f.tail[:0]
+	f.reader = bufio.NewReader(f.file)
+	f.told.Store(offset)
+	return nil
+}
+
+func (f *Follower) closeFile() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
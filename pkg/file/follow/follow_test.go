@@ -0,0 +1,197 @@
+package follow
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/metrics"
+)
+
+// long enough that a rotation done by the test is seen by the follower as one step
+const testPoll = time.Millisecond * 50
+
+func rotations(fileName, kind string) float64 {
+	var m dto.Metric
+	metrics.FileRotations.WithLabelValues(fileName, kind).Write(&m)
+	return m.GetCounter().GetValue()
+}
+
+func writeFile(t *testing.T, fileName, content string, flag int) {
+	t.Helper()
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|flag, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := io.WriteString(f, content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestFollower(t *testing.T, fileName string, opt ...Options) FollowerInterface {
+	t.Helper()
+	opt = append([]Options{WithFollow(true), WithReOpen(true), WithPoll(testPoll)}, opt...)
+	f, err := NewFollower(fileName, opt...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Stop() })
+	return f
+}
+
+// expect takes the next line and checks it and where the follower tells the following line starts
+func expect(t *testing.T, f FollowerInterface, text string, offset, tell int64) {
+	t.Helper()
+	select {
+	case line, ok := <-f.Lines():
+		if !ok {
+			t.Fatalf("lines closed, want %q", text)
+		}
+		if line.Text != text || line.Offset != offset {
+			t.Fatalf("line %q at %d, want %q at %d", line.Text, line.Offset, text, offset)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("no line, want %q", text)
+	}
+	// the follower moves Tell on right after the line is taken
+	deadline := time.Now().Add(time.Second)
+	for {
+		told, _ := f.Tell()
+		if told == tell {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tell %d after %q, want %d", told, text, tell)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectRotations(t *testing.T, fileName string, rename, truncate, remove float64) {
+	t.Helper()
+	for kind, want := range map[string]float64{RotationRename: rename, RotationTruncate: truncate, RotationRemove: remove} {
+		if got := rotations(fileName, kind); got != want {
+			t.Errorf("%s rotations %v, want %v", kind, got, want)
+		}
+	}
+}
+
+func TestRenameWithLateWrite(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, fileName, "a\n", 0)
+	f := newTestFollower(t, fileName)
+	expect(t, f, "a", 0, 2)
+
+	// the new file takes the name in one step, the writer still has the old one open
+	writeFile(t, fileName+".new", "c\n", 0)
+	if err := os.Rename(fileName, fileName+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(fileName+".new", fileName); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fileName+".1", "b\n", os.O_APPEND)
+
+	expect(t, f, "b", 2, 4)
+	expect(t, f, "c", 0, 2)
+	expectRotations(t, fileName, 1, 0, 0)
+}
+
+func TestCopyTruncate(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, fileName, "a\nb\n", 0)
+	f := newTestFollower(t, fileName)
+	expect(t, f, "a", 0, 2)
+	expect(t, f, "b", 2, 4)
+
+	writeFile(t, fileName, "c\n", os.O_TRUNC)
+	expect(t, f, "c", 0, 2)
+	expectRotations(t, fileName, 0, 1, 0)
+}
+
+func TestRemoveAndCreate(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, fileName, "a\n", 0)
+	f := newTestFollower(t, fileName)
+	expect(t, f, "a", 0, 2)
+
+	if err := os.Remove(fileName); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second * 5); rotations(fileName, RotationRemove) == 0; time.Sleep(testPoll) {
+		if time.Now().After(deadline) {
+			t.Fatal("remove not seen")
+		}
+	}
+	writeFile(t, fileName, "x\ny\n", 0)
+	expect(t, f, "x", 0, 2)
+	expect(t, f, "y", 2, 4)
+	expectRotations(t, fileName, 0, 0, 1)
+}
+
+func TestOffsetPastEnd(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, fileName, "abc\n", 0)
+	// the file was truncated while nobody followed it
+	f := newTestFollower(t, fileName, WithLocation(100, io.SeekStart))
+	expect(t, f, "abc", 0, 4)
+	expectRotations(t, fileName, 0, 0, 0)
+}
+
+func TestPartialLastLine(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, fileName, "a\nb", 0)
+	f := newTestFollower(t, fileName)
+	expect(t, f, "a", 0, 2)
+
+	// the line is sent once it is complete, from where it started
+	writeFile(t, fileName, "c\n", os.O_APPEND)
+	expect(t, f, "bc", 2, 5)
+	expectRotations(t, fileName, 0, 0, 0)
+}
+
+func TestPartialLastLineNoFollow(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, fileName, "a\nb", 0)
+	f := newTestFollower(t, fileName, WithFollow(false))
+	expect(t, f, "a", 0, 2)
+	expect(t, f, "b", 2, 3)
+	select {
+	case _, ok := <-f.Lines():
+		if ok {
+			t.Fatal("line after the end of the file")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("lines not closed at the end of the file")
+	}
+}
+
+func TestCopyTruncateWrittenPastOffset(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, fileName, "a\nb\n", 0)
+	f := newTestFollower(t, fileName)
+	expect(t, f, "a", 0, 2)
+	expect(t, f, "b", 2, 4)
+
+	// truncated and written past the old offset before the next poll
+	writeFile(t, fileName, "ccccc\nd\n", os.O_TRUNC)
+	expect(t, f, "ccccc", 0, 6)
+	expect(t, f, "d", 6, 8)
+	expectRotations(t, fileName, 0, 1, 0)
+}
+
+func TestStartOffsetThenTruncate(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, fileName, "a\nb\n", 0)
+	// the bytes before a saved offset tell the truncation too
+	f := newTestFollower(t, fileName, WithLocation(2, io.SeekStart))
+	expect(t, f, "b", 2, 4)
+
+	writeFile(t, fileName, "xyzxyz\n", os.O_TRUNC)
+	expect(t, f, "xyzxyz", 0, 7)
+	expectRotations(t, fileName, 0, 1, 0)
+}
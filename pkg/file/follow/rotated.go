@@ -0,0 +1,84 @@
+package follow
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/identity"
+)
+
+// FindRotated looks next to fileName for what became of the file of id, like app.log-20261017,
+// app.log.1 or app.log.1.gz; a renamed file keeps its inode, a copy or a compressed file its head
+func FindRotated(fileName string, id identity.Identity) (string, bool) {
+	matches, err := filepath.Glob(escapeGlob(fileName) + "?*")
+	if err != nil {
+		return "", false
+	}
+	var (
+		found   string
+		foundAt time.Time
+	)
+	for _, v := range matches {
+		cur, err := identity.Of(v)
+		if err != nil {
+			continue
+		}
+		// a removed file leaves its inode to the next file created, the head tells them apart
+		if id.SameInode(cur) && (id.HeadLen == 0 || sameHead(v, id)) {
+			return v, true
+		}
+		info, err := os.Stat(v)
+		if err != nil || (found != "" && !info.ModTime().After(foundAt)) {
+			continue
+		}
+		if sameHead(v, id) {
+			found, foundAt = v, info.ModTime()
+		}
+	}
+	return found, found != ""
+}
+
+func sameHead(fileName string, id identity.Identity) bool {
+	r, err := identity.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+	return id.SameHead(r)
+}
+
+func escapeGlob(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`).Replace(s)
+}
+
+// ReadRotated calls fn with every line of a rotated file from offset on, a gzip file is
+// read through and offset counts the bytes after decompression
+func ReadRotated(fileName string, offset int64, fn func(line *Line)) error {
+	r, err := identity.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+		return err
+	}
+	br := bufio.NewReader(r)
+	for {
+		text, err := br.ReadString('\n')
+		if text != "" {
+			fn(&Line{Text: strings.TrimRight(text, "\n"), Offset: offset, Time: time.Now()})
+			offset += int64(len(text))
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
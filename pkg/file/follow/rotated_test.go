@@ -0,0 +1,166 @@
+package follow
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/identity"
+)
+
+func identityOf(t *testing.T, fileName string) identity.Identity {
+	t.Helper()
+	id, err := identity.Of(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func writeGzip(t *testing.T, fileName, content string) {
+	t.Helper()
+	f, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readRotated(t *testing.T, fileName string, offset int64) []Line {
+	t.Helper()
+	var lines []Line
+	if err := ReadRotated(fileName, offset, func(line *Line) {
+		lines = append(lines, Line{Text: line.Text, Offset: line.Offset})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestFindRotatedByInode(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	writeFile(t, fileName, "a\nb\n", 0)
+	id := identityOf(t, fileName)
+
+	// a decoy with the same head, only the inode tells the renamed file
+	writeFile(t, fileName+".2", "a\nb\n", 0)
+	if err := os.Rename(fileName, fileName+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fileName, "c\n", 0)
+	if got, ok := FindRotated(fileName, id); !ok || got != fileName+".1" {
+		t.Fatalf("found %q %v", got, ok)
+	}
+}
+
+func TestFindRotatedByHead(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	content := strings.Repeat("0123456789abcdef\n", 100)
+	writeFile(t, fileName, content, 0)
+	id := identityOf(t, fileName)
+
+	// copied and compressed by the rotation, the file the checkpoint was of is gone
+	writeGzip(t, fileName+".1.gz", content+"late\n")
+	writeFile(t, fileName+".2", "older\n", 0)
+	if err := os.Remove(fileName); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fileName, "new\n", 0)
+	if cur := identityOf(t, fileName); id.SameInode(cur) && id.Head == cur.Head {
+		t.Fatal("new file has the identity of the old one")
+	}
+	got, ok := FindRotated(fileName, id)
+	if !ok || got != fileName+".1.gz" {
+		t.Fatalf("found %q %v", got, ok)
+	}
+
+	// read from the offset in the decompressed content
+	want := []Line{{Text: "late", Offset: int64(len(content))}}
+	if lines := readRotated(t, got, int64(len(content))); !reflect.DeepEqual(lines, want) {
+		t.Fatalf("lines %v, want %v", lines, want)
+	}
+}
+
+func TestFindRotatedNewest(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	writeFile(t, fileName, "same head\n", 0)
+	id := identityOf(t, fileName)
+
+	// two copies of the head, the one written last is the rotation of the file
+	old := time.Now().Add(-time.Hour)
+	writeFile(t, fileName+"-20261016", "same head\nold\n", 0)
+	if err := os.Chtimes(fileName+"-20261016", old, old); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fileName+"-20261017", "same head\nnew\n", 0)
+	os.Remove(fileName)
+	if got, ok := FindRotated(fileName, id); !ok || got != fileName+"-20261017" {
+		t.Fatalf("found %q %v", got, ok)
+	}
+}
+
+func TestFindRotatedInodeReused(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	writeFile(t, fileName, "a\n", 0)
+	id := identityOf(t, fileName)
+	os.Remove(fileName)
+
+	// most file systems give the removed inode to the next file
+	writeFile(t, fileName+".1", "b\n", 0)
+	if got, ok := FindRotated(fileName, id); ok {
+		t.Fatalf("found %q", got)
+	}
+}
+
+func TestFindRotatedNone(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app[1].log")
+	writeFile(t, fileName, "a\n", 0)
+	id := identityOf(t, fileName)
+	os.Remove(fileName)
+	writeFile(t, fileName+".1", "b\n", 0)
+	// the name is no glob, app1.log is not a rotation of app[1].log
+	writeFile(t, filepath.Join(dir, "app1.log.1"), "a\n", 0)
+	if got, ok := FindRotated(fileName, id); ok {
+		t.Fatalf("found %q", got)
+	}
+	if got, ok := FindRotated(fileName, identity.Identity{}); ok {
+		t.Fatalf("found %q without identity", got)
+	}
+}
+
+func TestReadRotated(t *testing.T) {
+	dir := t.TempDir()
+	for name, write := range map[string]func(string, string){
+		"app.log.1":    func(f, c string) { writeFile(t, f, c, 0) },
+		"app.log.1.gz": func(f, c string) { writeGzip(t, f, c) },
+	} {
+		fileName := filepath.Join(dir, name)
+		write(fileName, "a\nbb\nc")
+		want := []Line{{Text: "bb", Offset: 2}, {Text: "c", Offset: 5}}
+		if lines := readRotated(t, fileName, 2); !reflect.DeepEqual(lines, want) {
+			t.Errorf("%s: lines %v, want %v", name, lines, want)
+		}
+		if lines := readRotated(t, fileName, 6); len(lines) != 0 {
+			t.Errorf("%s: lines %v after the end", name, lines)
+		}
+		if err := ReadRotated(fileName, 100, func(*Line) {}); err == nil {
+			t.Errorf("%s: offset past the end read", name)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package identity
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+)
+
+// HeadSize is how many of the first bytes of a file tell it apart from another file
+const HeadSize = 1024
+
+// Identity of a file survives a rename through Dev and Ino, and a copy through Head
+type Identity struct {
+	Dev uint64 `json:"dev,omitempty"`
+	Ino uint64 `json:"ino,omitempty"`
+	// hash of the first HeadLen bytes, HeadLen is under HeadSize while the file is shorter
+	Head    string `json:"head,omitempty"`
+	HeadLen int    `json:"headLen,omitempty"`
+}
+
+func Of(fileName string) (Identity, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return Identity{}, err
+	}
+	defer f.Close()
+	return OfFile(f)
+}
+
+// Stat is the identity of fileName without its head, it does not read the file
+func Stat(fileName string) (Identity, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return Identity{}, err
+	}
+	return fromInfo(info), nil
+}
+
+// OfFile does not move the offset of f
+func OfFile(f *os.File) (Identity, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return Identity{}, err
+	}
+	id := fromInfo(info)
+	id.Head, id.HeadLen, err = head(io.NewSectionReader(f, 0, HeadSize), HeadSize)
+	return id, err
+}
+
+func (id Identity) IsZero() bool {
+	return id == Identity{}
+}
+
+func (id Identity) SameInode(o Identity) bool {
+	return id.Ino != 0 && id.Dev == o.Dev && id.Ino == o.Ino
+}
+
+// SameHead reports whether r starts with the bytes the head of id was taken from
+func (id Identity) SameHead(r io.Reader) bool {
+	if id.HeadLen == 0 {
+		return false
+	}
+	h, n, err := head(r, id.HeadLen)
+	return err == nil && n == id.HeadLen && h == id.Head
+}
+
+// Same reports whether fileName is still the file of id, not a new one behind the same name
+func (id Identity) Same(fileName string) bool {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	cur, err := OfFile(f)
+	if err != nil || (id.Ino != 0 && !id.SameInode(cur)) {
+		return false
+	}
+	return id.HeadLen == 0 || id.SameHead(io.NewSectionReader(f, 0, int64(id.HeadLen)))
+}
+
+// Key tells the file apart from any other, as long as its head does not change
+func (id Identity) Key() string {
+	return fmt.Sprintf("%d:%d:%s", id.Dev, id.Ino, id.Head)
+}
+
+func head(r io.Reader, n int) (string, int, error) {
+	h := fnv.New64a()
+	read, err := io.CopyN(h, r, int64(n))
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+	if read == 0 {
+		return "", 0, nil
+	}
+	return fmt.Sprintf("%016x", h.Sum64()), int(read), nil
+}
+
+// Open reads fileName, through gzip when it starts with the gzip magic bytes
+func Open(fileName string) (io.ReadCloser, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &readCloser{Reader: zr, close: f.Close}, nil
+	}
+	return &readCloser{Reader: br, close: f.Close}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc *readCloser) Close() error {
+	return rc.close()
+}
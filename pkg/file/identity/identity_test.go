@@ -0,0 +1,115 @@
+package identity
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, fileName, content string, flag int) {
+	t.Helper()
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|flag, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func of(t *testing.T, fileName string) Identity {
+	t.Helper()
+	id, err := Of(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestGrowingFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, fileName, "short\n", 0)
+	small := of(t, fileName)
+	if small.HeadLen != 6 || small.Ino == 0 {
+		t.Fatalf("identity %+v", small)
+	}
+
+	// a file under HeadSize is still itself as it grows, its key changes
+	writeFile(t, fileName, strings.Repeat("x", HeadSize*2), os.O_APPEND)
+	grown := of(t, fileName)
+	if !small.Same(fileName) || !grown.Same(fileName) {
+		t.Fatal("grown file is another file")
+	}
+	if grown.HeadLen != HeadSize || grown.Key() == small.Key() || !small.SameInode(grown) {
+		t.Fatalf("identity %+v after growing, was %+v", grown, small)
+	}
+}
+
+func TestNotSame(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	writeFile(t, fileName, "first file\n", 0)
+	id := of(t, fileName)
+
+	// truncated and written again in place
+	writeFile(t, fileName, "second file\n", os.O_TRUNC)
+	if id.Same(fileName) {
+		t.Fatal("rewritten file is the same")
+	}
+
+	// the same head behind another inode
+	writeFile(t, fileName+".new", "first file\n", 0)
+	if err := os.Rename(fileName+".new", fileName); err != nil {
+		t.Fatal(err)
+	}
+	if id.Same(fileName) {
+		t.Fatal("new inode is the same file")
+	}
+	if id.Same(filepath.Join(dir, "missing.log")) {
+		t.Fatal("missing file is the same")
+	}
+}
+
+func TestStat(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, fileName, "a\n", 0)
+	st, err := Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := of(t, fileName); !id.SameInode(st) || st.HeadLen != 0 {
+		t.Fatalf("stat %+v, identity %+v", st, id)
+	}
+}
+
+func TestHeadOfGzip(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	content := strings.Repeat("line of the log\n", 100)
+	writeFile(t, fileName, content, 0)
+	id := of(t, fileName)
+
+	f, err := os.Create(fileName + ".1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte(content))
+	zw.Close()
+	f.Close()
+
+	r, err := Open(fileName + ".1.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if !id.SameHead(r) {
+		t.Fatal("compressed copy has another head")
+	}
+	if (Identity{}).SameHead(strings.NewReader(content)) {
+		t.Fatal("no head is the same as any")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package identity
+
+import (
+	"os"
+	"syscall"
+)
+
+func fromInfo(info os.FileInfo) Identity {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return Identity{}
+	}
+	return Identity{Dev: uint64(st.Dev), Ino: uint64(st.Ino)}
+}
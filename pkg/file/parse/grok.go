@@ -0,0 +1,140 @@
+package parse
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const grokMaxDepth = 64
+
+var (
+	// %{NAME}, %{NAME:field} or %{NAME:field:type}, type is accepted but every field is a string
+	grokReference = regexp.MustCompile(`%\{(\w+)(?::([\w.@\[\]-]+))?(?::\w+)?\}`)
+	// oniguruma named group that go regexp does not know before go 1.22
+	grokNamedGroup = regexp.MustCompile(`\(\?<([A-Za-z_]\w*)>`)
+)
+
+// GrokParser turns a line into the fields named in a grok pattern like %{IP:client} %{NUMBER:status}
+type GrokParser struct {
+	reg *regexp.Regexp
+	// field name of every capture group, empty for the unnamed ones
+	names []string
+}
+
+func NewGrokParser(pattern string, patternFiles []string) (ParserInterface, error) {
+	if pattern == "" {
+		return nil, errors.New("grok format needs a grok pattern")
+	}
+	patterns := make(map[string]string, len(grokPatterns))
+	for k, v := range grokPatterns {
+		patterns[k] = v
+	}
+	for _, v := range patternFiles {
+		if err := loadGrokPatterns(v, patterns); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &grokCompiler{patterns: patterns, fields: make(map[string]string)}
+	expanded, err := c.expand(pattern, 0)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("compile grok pattern %q failed: %w", pattern, err)
+	}
+	gp := &GrokParser{
+		reg:   reg,
+		names: make([]string, len(reg.SubexpNames())),
+	}
+	for i, v := range reg.SubexpNames() {
+		if field, ok := c.fields[v]; ok {
+			gp.names[i] = field
+		} else {
+			gp.names[i] = v
+		}
+	}
+	return gp, nil
+}
+
+func (gp *GrokParser) Parse(line string) (map[string]string, error) {
+	sub := gp.reg.FindStringSubmatch(line)
+	if sub == nil {
+		return nil, errors.New("line does not match grok pattern")
+	}
+	fields := make(map[string]string, len(gp.names))
+	for i, v := range gp.names {
+		// an optional group that did not take part must not hide the same field matched elsewhere
+		if v != "" && sub[i] != "" {
+			fields[v] = sub[i]
+		}
+	}
+	return fields, nil
+}
+
+type grokCompiler struct {
+	patterns map[string]string
+	// capture group name to field name
+	fields map[string]string
+}
+
+func (c *grokCompiler) expand(pattern string, depth int) (string, error) {
+	if depth > grokMaxDepth {
+		return "", fmt.Errorf("grok pattern %q nests too deep, is it recursive?", pattern)
+	}
+	var err error
+	expanded := grokReference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		sub := grokReference.FindStringSubmatch(ref)
+		def, ok := c.patterns[sub[1]]
+		if !ok {
+			err = fmt.Errorf("unknown grok pattern %q", sub[1])
+			return ref
+		}
+		var inner string
+		if inner, err = c.expand(def, depth+1); err != nil {
+			return ref
+		}
+		if sub[2] == "" {
+			return "(?:" + inner + ")"
+		}
+		group := "grok" + strconv.Itoa(len(c.fields))
+		c.fields[group] = sub[2]
+		return "(?P<" + group + ">" + inner + ")"
+	})
+	if err != nil {
+		return "", err
+	}
+	return grokNamedGroup.ReplaceAllString(expanded, "(?P<$1>"), nil
+}
+
+// loadGrokPatterns reads a logstash pattern file, every line is NAME regex
+func loadGrokPatterns(fileName string, patterns map[string]string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("open grok pattern file failed: %w", err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, def, ok := strings.Cut(line, " ")
+		if !ok {
+			return fmt.Errorf("grok pattern file %s line %d: no regex after %q", fileName, n, name)
+		}
+		patterns[name] = strings.TrimSpace(def)
+	}
+	return s.Err()
+}
@@ -0,0 +1,49 @@
+package parse
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// JsonParser flattens nested objects, {"error":{"code":1}} becomes error.code=1
+type JsonParser struct{}
+
+func NewJsonParser() ParserInterface {
+	return &JsonParser{}
+}
+
+func (jp *JsonParser) Parse(line string) (map[string]string, error) {
+	var obj map[string]any
+	d := json.NewDecoder(strings.NewReader(line))
+	d.UseNumber()
+	if err := d.Decode(&obj); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(obj))
+	flatten("", obj, fields)
+	return fields, nil
+}
+
+func flatten(prefix string, obj map[string]any, fields map[string]string) {
+	for k, v := range obj {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		switch value := v.(type) {
+		case map[string]any:
+			flatten(k, value, fields)
+		case string:
+			fields[k] = value
+		case json.Number:
+			fields[k] = value.String()
+		case bool:
+			fields[k] = strconv.FormatBool(value)
+		case nil:
+			fields[k] = ""
+		default:
+			content, _ := json.Marshal(value)
+			fields[k] = string(content)
+		}
+	}
+}
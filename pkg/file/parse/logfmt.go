@@ -0,0 +1,37 @@
+package parse
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-logfmt/logfmt"
+)
+
+// LogfmtParser reads level=error caller=main.go:12 msg="some thing" into fields
+type LogfmtParser struct{}
+
+func NewLogfmtParser() ParserInterface {
+	return &LogfmtParser{}
+}
+
+func (lp *LogfmtParser) Parse(line string) (map[string]string, error) {
+	d := logfmt.NewDecoder(strings.NewReader(line))
+	fields := make(map[string]string, 8)
+	pairs := 0
+	for d.ScanRecord() {
+		for d.ScanKeyval() {
+			// a bare word has no value, plain text is all bare words
+			if d.Value() != nil {
+				pairs++
+			}
+			fields[string(d.Key())] = string(d.Value())
+		}
+	}
+	if err := d.Err(); err != nil {
+		return nil, err
+	}
+	if pairs == 0 {
+		return nil, errors.New("no key value in line")
+	}
+	return fields, nil
+}
@@ -0,0 +1,35 @@
+package parse
+
+import (
+	"fmt"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+)
+
+const (
+	FormatText   = "text"
+	FormatJson   = "json"
+	FormatLogfmt = "logfmt"
+	FormatGrok   = "grok"
+)
+
+// ParserInterface turns a line into fields that rules and labels can use
+type ParserInterface interface {
+	Parse(line string) (map[string]string, error)
+}
+
+// NewParser returns nil for plain text, there is nothing to parse
+func NewParser(rule *conf.List) (ParserInterface, error) {
+	switch rule.Format {
+	case "", FormatText:
+		return nil, nil
+	case FormatJson:
+		return NewJsonParser(), nil
+	case FormatLogfmt:
+		return NewLogfmtParser(), nil
+	case FormatGrok:
+		return NewGrokParser(rule.GrokPattern, rule.GrokPatternFiles)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", rule.Format)
+	}
+}
@@ -1,5 +1,7 @@
 package resolve
 
+import "sync"
+
 type Status int
 
 const (
@@ -11,13 +13,18 @@ type Option func(*Resolved)
 
 type Resolved struct {
 	AppName    []string
+	lock       sync.Mutex
 	statusSave map[string]Status
+	// the status of the last run
+	saved map[string]Status
 }
 
 type ResolveInterface interface {
 	Alarm(appName string)
 	Resolve(appName string)
 	Range(f func(appName string))
+	// Status of every app, to be handed to WithStatus after a restart
+	Status() map[string]Status
 }
 
 func NewResolver(opt ...Option) ResolveInterface {
@@ -25,6 +32,7 @@ func NewResolver(opt ...Option) ResolveInterface {
 	for _, v := range opt {
 		v(r)
 	}
+	r.newStatus()
 	return r
 }
 
@@ -34,15 +42,26 @@ func WithAppName(appName []string) Option {
 	}
 }
 
+// WithStatus carries on from the status of the last run, apps no longer in AppName are left out
+func WithStatus(status map[string]Status) Option {
+	return func(r *Resolved) {
+		r.saved = status
+	}
+}
+
 func defaultResolve() *Resolved {
 	return &Resolved{}
 }
 
 func (r *Resolved) Alarm(appName string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 	r.statusSave[appName] = StatusFiring
 }
 
 func (r *Resolved) Resolve(appName string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 	r.statusSave[appName] = StatusResolved
 }
 
@@ -50,13 +69,27 @@ func (r *Resolved) newStatus() {
 	r.statusSave = make(map[string]Status, len(r.AppName))
 	for _, v := range r.AppName {
 		r.statusSave[v] = StatusResolved
+		if s, ok := r.saved[v]; ok {
+			r.statusSave[v] = s
+		}
 	}
+	r.saved = nil
 }
 
 func (r *Resolved) Range(f func(appName string)) {
-	for k, v := range r.statusSave {
+	for k, v := range r.Status() {
 		if v == StatusFiring {
 			f(k)
 		}
 	}
 }
+
+func (r *Resolved) Status() map[string]Status {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	status := make(map[string]Status, len(r.statusSave))
+	for k, v := range r.statusSave {
+		status[k] = v
+	}
+	return status
+}
@@ -0,0 +1,305 @@
+package savepostion
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+const (
+	// 1 is the bare map written before the file had a version
+	positionVersion = 2
+
+	tempSuffix   = ".tmp"
+	backupSuffix = ".bak"
+	// followed by the time the damaged files were moved aside
+	damagedSuffix = ".damaged."
+)
+
+type positionFile struct {
+	Version int `json:"version"`
+	// crc32 of Positions followed by Buckets
+	Checksum  uint32          `json:"checksum"`
+	Positions json.RawMessage `json:"positions"`
+	// the buckets other than positions
+	Buckets json.RawMessage `json:"buckets,omitempty"`
+}
+
+// jsonStore keeps every bucket in one json file, rewritten whole on every Save
+type jsonStore struct {
+	fileName string
+	l        log.Logger
+	lock     sync.Mutex
+	data     map[string]map[string]json.RawMessage
+}
+
+func newJsonStore(fileName string, l log.Logger) (*jsonStore, error) {
+	js := &jsonStore{
+		fileName: fileName,
+		l:        l,
+		data:     make(map[string]map[string]json.RawMessage),
+	}
+	positions, buckets, err := js.LoadFile()
+	if err != nil {
+		if !errors.Is(err, errDamaged) {
+			return nil, err
+		}
+		level.Error(l).Log("position file and backup damaged, start over, err", err, "kept", strings.Join(js.keepDamaged(), ","))
+		return js, nil
+	}
+	if len(positions) > 0 {
+		var p map[string]json.RawMessage
+		if err := json.Unmarshal(positions, &p); err != nil {
+			return nil, err
+		}
+		js.data[BucketPositions] = p
+	}
+	if len(buckets) > 0 {
+		var b map[string]map[string]json.RawMessage
+		if err := json.Unmarshal(buckets, &b); err != nil {
+			return nil, err
+		}
+		for k, v := range b {
+			js.data[k] = v
+		}
+	}
+	return js, nil
+}
+
+func (js *jsonStore) Load(bucket string, f func(key string, value []byte)) error {
+	js.lock.Lock()
+	b := make(map[string]json.RawMessage, len(js.data[bucket]))
+	for k, v := range js.data[bucket] {
+		b[k] = v
+	}
+	js.lock.Unlock()
+
+	for k, v := range b {
+		f(k, v)
+	}
+	return nil
+}
+
+func (js *jsonStore) Save(bucket string, values map[string][]byte) error {
+	if len(values) == 0 {
+		return nil
+	}
+	js.lock.Lock()
+	defer js.lock.Unlock()
+
+	b := js.data[bucket]
+	if b == nil {
+		b = make(map[string]json.RawMessage, len(values))
+		js.data[bucket] = b
+	}
+	for k, v := range values {
+		if v == nil {
+			delete(b, k)
+			continue
+		}
+		b[k] = v
+	}
+
+	positions, err := json.Marshal(js.data[BucketPositions])
+	if err != nil {
+		return err
+	}
+	others := make(map[string]map[string]json.RawMessage, len(js.data))
+	for k, v := range js.data {
+		if k != BucketPositions && len(v) > 0 {
+			others[k] = v
+		}
+	}
+	var buckets []byte
+	if len(others) > 0 {
+		if buckets, err = json.Marshal(others); err != nil {
+			return err
+		}
+	}
+	return js.SaveFile(positions, buckets)
+}
+
+func (js *jsonStore) Close() error {
+	return nil
+}
+
+// SaveFile replaces the position file through a synced temp file, the file it
+// replaces is copied to the backup first, so there is a good position file all along
+func (js *jsonStore) SaveFile(positions, buckets []byte) error {
+	// Marshal compacts raw messages, the checksum has to be of what is written
+	var p, b bytes.Buffer
+	if err := json.Compact(&p, positions); err != nil {
+		return err
+	}
+	if len(buckets) > 0 {
+		if err := json.Compact(&b, buckets); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(&positionFile{
+		Version:   positionVersion,
+		Checksum:  checksum(p.Bytes(), b.Bytes()),
+		Positions: p.Bytes(),
+		Buckets:   b.Bytes(),
+	})
+	if err != nil {
+		return err
+	}
+
+	// only a file that still reads well becomes the backup
+	if old, err := os.ReadFile(js.fileName); err == nil {
+		if _, _, err := parseFile(js.fileName, old); err == nil {
+			if err := writeFile(js.fileName+backupSuffix, old); err != nil {
+				level.Warn(js.l).Log("keep backup of position file failed, err", err)
+			}
+		}
+	}
+	if err := writeFile(js.fileName, data); err != nil {
+		level.Error(js.l).Log("save file error", err)
+		return err
+	}
+	return nil
+}
+
+// writeFile replaces fileName with data in one rename, a crash leaves either the old or the new file
+func writeFile(fileName string, data []byte) error {
+	temp := fileName + tempSuffix
+	f, err := os.OpenFile(temp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	if err := os.Rename(temp, fileName); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return syncDir(filepath.Dir(fileName))
+}
+
+// LoadFile returns the positions and the other buckets of the position file, or of its backup when the file
+// is missing or damaged, the error wraps errDamaged when neither can be read
+func (js *jsonStore) LoadFile() ([]byte, []byte, error) {
+	positions, buckets, err := readFile(js.fileName)
+	if err == nil {
+		return positions, buckets, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, errDamaged) {
+		return nil, nil, err
+	}
+	positions, buckets, berr := readFile(js.fileName + backupSuffix)
+	if berr == nil {
+		level.Warn(js.l).Log("position file unusable, load backup, err", err)
+		return positions, buckets, nil
+	}
+	switch {
+	case errors.Is(err, os.ErrNotExist) && errors.Is(berr, os.ErrNotExist):
+		// the first start, find out now that the position file can be written
+		return nil, nil, writable(js.fileName)
+	case errors.Is(err, os.ErrNotExist):
+		return nil, nil, berr
+	case errors.Is(berr, os.ErrNotExist):
+		return nil, nil, err
+	}
+	return nil, nil, fmt.Errorf("%w, backup: %v", err, berr)
+}
+
+func writable(fileName string) error {
+	temp := fileName + tempSuffix
+	f, err := os.OpenFile(temp, os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(temp)
+}
+
+// keepDamaged moves the position file and its backup aside, so starting over does not overwrite them
+func (js *jsonStore) keepDamaged() []string {
+	suffix := damagedSuffix + time.Now().Format("20060102150405")
+	var kept []string
+	for _, v := range []string{js.fileName, js.fileName + backupSuffix} {
+		if err := os.Rename(v, v+suffix); err == nil {
+			kept = append(kept, v+suffix)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			level.Error(js.l).Log("keep damaged position file failed, file", v, "err", err)
+		}
+	}
+	return kept
+}
+
+var errDamaged = errors.New("position file damaged")
+
+func checksum(positions, buckets []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(positions), crc32.IEEETable, buckets)
+}
+
+func readFile(fileName string) ([]byte, []byte, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseFile(fileName, data)
+}
+
+func parseFile(fileName string, data []byte) ([]byte, []byte, error) {
+	// every save writes at least the version, an empty file was cut short
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil, fmt.Errorf("%w: %s is empty", errDamaged, fileName)
+	}
+	var pf positionFile
+	if err := json.Unmarshal(data, &pf); err != nil || pf.Version == 0 {
+		positions, err := readBare(data)
+		return positions, nil, err
+	}
+	if pf.Version > positionVersion {
+		return nil, nil, fmt.Errorf("%w: version %d is newer than %d", errDamaged, pf.Version, positionVersion)
+	}
+	if checksum(pf.Positions, pf.Buckets) != pf.Checksum {
+		return nil, nil, fmt.Errorf("%w: checksum mismatch in %s", errDamaged, fileName)
+	}
+	return pf.Positions, pf.Buckets, nil
+}
+
+// readBare reads the map the position file was before it had a version, which a shorter
+// write could leave followed by the end of a longer one
+func readBare(data []byte) ([]byte, error) {
+	var positions json.RawMessage
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&positions); err != nil {
+		return nil, fmt.Errorf("%w: %v", errDamaged, err)
+	}
+	var bare map[string]FileInfo
+	if err := json.Unmarshal(positions, &bare); err != nil {
+		return nil, fmt.Errorf("%w: %v", errDamaged, err)
+	}
+	return positions, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// some file systems cannot sync a directory, the rename is still done
+	d.Sync()
+	return nil
+}
@@ -0,0 +1,178 @@
+package savepostion
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func newTestStore(t *testing.T, fileName string) *jsonStore {
+	t.Helper()
+	js, err := newJsonStore(fileName, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
+
+func save(t *testing.T, js *jsonStore, key, value string) {
+	t.Helper()
+	if err := js.Save(BucketPositions, map[string][]byte{key: []byte(value)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// positions of the store, by key
+func positions(js *jsonStore) map[string]string {
+	p := make(map[string]string)
+	js.Load(BucketPositions, func(key string, value []byte) {
+		p[key] = string(value)
+	})
+	return p
+}
+
+func expectPositions(t *testing.T, js *jsonStore, want map[string]string) {
+	t.Helper()
+	got := positions(js)
+	if len(got) != len(want) {
+		t.Fatalf("positions %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("positions %v, want %v", got, want)
+		}
+	}
+}
+
+func exists(fileName string) bool {
+	_, err := os.Stat(fileName)
+	return err == nil
+}
+
+func TestMissingFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "position")
+	js := newTestStore(t, fileName)
+	expectPositions(t, js, nil)
+	if exists(fileName) || exists(fileName+tempSuffix) {
+		t.Fatal("loading created a position file")
+	}
+
+	save(t, js, "a", `{"offset":1}`)
+	expectPositions(t, newTestStore(t, fileName), map[string]string{"a": `{"offset":1}`})
+}
+
+func TestMissingFileWithBackup(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "position")
+	js := newTestStore(t, fileName)
+	save(t, js, "a", `{"offset":1}`)
+	save(t, js, "a", `{"offset":2}`)
+
+	// a crash between taking the file away and putting the new one in place
+	if err := os.Remove(fileName); err != nil {
+		t.Fatal(err)
+	}
+	expectPositions(t, newTestStore(t, fileName), map[string]string{"a": `{"offset":1}`})
+}
+
+func TestEmptyFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "position")
+	js := newTestStore(t, fileName)
+	save(t, js, "a", `{"offset":1}`)
+	save(t, js, "a", `{"offset":2}`)
+
+	if err := os.Truncate(fileName, 0); err != nil {
+		t.Fatal(err)
+	}
+	js = newTestStore(t, fileName)
+	expectPositions(t, js, map[string]string{"a": `{"offset":1}`})
+
+	// the empty file does not become the backup
+	save(t, js, "b", `{"offset":3}`)
+	if err := os.Remove(fileName); err != nil {
+		t.Fatal(err)
+	}
+	expectPositions(t, newTestStore(t, fileName), map[string]string{"a": `{"offset":1}`})
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "position")
+	js := newTestStore(t, fileName)
+	save(t, js, "a", `{"offset":1}`)
+	save(t, js, "a", `{"offset":2}`)
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), `"offset":2`, `"offset":9`, 1))
+	if err := os.WriteFile(fileName, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readFile(fileName); err == nil {
+		t.Fatal("changed file read well")
+	}
+	expectPositions(t, newTestStore(t, fileName), map[string]string{"a": `{"offset":1}`})
+}
+
+func TestBareFormat(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "position")
+	// the file before it had a version, a shorter write left the end of a longer one behind it
+	bare := `{"app":{"offset":5,"appName":"app","fileName":"/var/log/app.log"}}` + `"}}`
+	if err := os.WriteFile(fileName, []byte(bare), 0666); err != nil {
+		t.Fatal(err)
+	}
+	js := newTestStore(t, fileName)
+	p := positions(js)
+	var fi FileInfo
+	if err := json.Unmarshal([]byte(p["app"]), &fi); err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 1 || fi.Offset != 5 || fi.FileName != "/var/log/app.log" {
+		t.Fatalf("positions %v", p)
+	}
+
+	// the next save writes the current format
+	save(t, js, "b", `{"offset":1}`)
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pf positionFile
+	if err := json.Unmarshal(data, &pf); err != nil || pf.Version != positionVersion {
+		t.Fatalf("saved %s", data)
+	}
+}
+
+func TestFileAndBackupDamaged(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "position")
+	if err := os.WriteFile(fileName, []byte("{\"version\":2,"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fileName+backupSuffix, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	js := newTestStore(t, fileName)
+	expectPositions(t, js, nil)
+
+	kept, err := filepath.Glob(filepath.Join(dir, "*"+damagedSuffix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 2 || exists(fileName) || exists(fileName+backupSuffix) {
+		t.Fatalf("damaged files not kept aside, kept %v", kept)
+	}
+
+	// starting over leaves the kept files alone
+	save(t, js, "a", `{"offset":1}`)
+	save(t, js, "a", `{"offset":2}`)
+	for _, v := range kept {
+		if !exists(v) {
+			t.Fatalf("%s is gone", v)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+
+package savepostion
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile holds an exclusive lock on fileName until the returned file is closed,
+// the kernel lets it go when the process dies
+func lockFile(fileName string) (*os.File, error) {
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
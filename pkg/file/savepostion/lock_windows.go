@@ -0,0 +1,10 @@
+//go:build windows
+
+package savepostion
+
+import "os"
+
+// lockFile on windows only keeps the lock file open, it does not keep a second instance out
+func lockFile(fileName string) (*os.File, error) {
+	return os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0666)
+}
@@ -1,60 +1,175 @@
 package savepostion
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
-	"io"
+	"fmt"
 	"os"
 	"sync"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/identity"
 )
 
+const lockSuffix = ".lock"
+
+var ErrLocked = errors.New("position store is held by a running exporter")
+
 var (
-	appInfo = make(map[string]*FileInfo, 2*len(conf.AppConfig.LogFile.List))
+	// checkpoints by Key of the file, the app name is kept in FileInfo
+	appInfo = make(map[string]*FileInfo)
+	// keys of appInfo by file name and by inode, set keeps one checkpoint of each
+	byName  = make(map[string]string)
+	byInode = make(map[inode]string)
 	lock    = sync.Mutex{}
 )
 
+type inode struct {
+	dev, ino uint64
+}
+
 type SavePos struct {
 	FilePosition string
-	l            log.Logger
+	// json or kv
+	Store string
+	l     log.Logger
+	store StoreInterface
+	// held while the store is open, so a positions command never edits it under a running exporter
+	lock *os.File
+	// what the store has of every bucket, so only changes are saved
+	savedLock sync.Mutex
+	saved     map[string]map[string]string
+}
+
+type Options func(*SavePos)
+
+// WithStore picks the store of the checkpoints, json (default) or kv
+func WithStore(kind string) Options {
+	return func(sp *SavePos) {
+		sp.Store = kind
+	}
 }
 
 type FIInput struct {
 	FileName string `json:"fileName,omitempty"`
 	Offset   int64  `json:"offset,omitempty"`
 	AppName  string `json:"appName,omitempty"`
+	// the file Offset is in, to find it again once it is rotated
+	identity.Identity
+}
+
+// Key of the checkpoint of a file, the name only stands in for the inode where there is none
+func Key(fileName string, id identity.Identity) string {
+	if id.Ino == 0 {
+		return fileName + ":" + id.Head
+	}
+	return id.Key()
 }
 
 func set(in *FileInfo) {
 	lock.Lock()
 	defer lock.Unlock()
 
-	appInfo[in.AppName] = &FileInfo{
+	old, ok := appInfo[byName[in.FileName]]
+	// a checkpoint without identity does not replace the identity of the file
+	if in.Identity.IsZero() && ok {
+		in.Identity = old.Identity
+	}
+	key := Key(in.FileName, in.Identity)
+	// a file under HeadSize gets a new head as it grows, and an older file of the name is done with
+	if ok {
+		remove(byName[in.FileName])
+	}
+	if k, ok := byInode[inode{in.Dev, in.Ino}]; ok && in.Ino != 0 {
+		remove(k)
+	}
+	remove(key)
+	appInfo[key] = &FileInfo{
 		Offset:   in.Offset,
 		AppName:  in.AppName,
 		FileName: in.FileName,
+		Identity: in.Identity,
+	}
+	byName[in.FileName] = key
+	if in.Ino != 0 {
+		byInode[inode{in.Dev, in.Ino}] = key
+	}
+}
+
+func remove(key string) {
+	v, ok := appInfo[key]
+	if !ok {
+		return
+	}
+	delete(appInfo, key)
+	if byName[v.FileName] == key {
+		delete(byName, v.FileName)
+	}
+	if byInode[inode{v.Dev, v.Ino}] == key {
+		delete(byInode, inode{v.Dev, v.Ino})
 	}
 }
 
 func Get(key string) *FileInfo {
+	lock.Lock()
+	defer lock.Unlock()
 	return appInfo[key]
 }
 
-func NewSavePos(filePosition string, l log.Logger) *SavePos {
-	return &SavePos{
+// Lookup returns the checkpoint of the file behind fileName, same is false when the
+// checkpoint is of an older file that had the name and was rotated since
+func Lookup(fileName string) (fi *FileInfo, same bool) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	fi = appInfo[byName[fileName]]
+	// written before checkpoints had an identity
+	if fi != nil && fi.Identity.IsZero() {
+		return fi, true
+	}
+	// the file may have had another name when it was saved, it is found by its inode
+	cur, err := identity.Stat(fileName)
+	if err != nil {
+		return fi, false
+	}
+	if cur.Ino == 0 {
+		return fi, fi != nil && fi.Identity.Same(fileName)
+	}
+	if v, ok := appInfo[byInode[inode{cur.Dev, cur.Ino}]]; ok && v.Identity.Same(fileName) {
+		return v, true
+	}
+	return fi, false
+}
+
+func NewSavePos(filePosition string, l log.Logger, opt ...Options) (*SavePos, error) {
+	sp := &SavePos{
 		FilePosition: filePosition,
 		l:            l,
+		saved:        make(map[string]map[string]string),
+	}
+	for _, o := range opt {
+		o(sp)
+	}
+	lock, err := lockFile(filePosition + lockSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("lock position store %s: %w", filePosition, err)
+	}
+	store, err := newStore(sp.Store, filePosition, l)
+	if err != nil {
+		lock.Close()
+		return nil, err
 	}
+	sp.store = store
+	sp.lock = lock
+	return sp, nil
 }
 func (sp *SavePos) HotSave(v *FIInput) {
 	set(&FileInfo{
 		Offset:   v.Offset,
 		AppName:  v.AppName,
 		FileName: v.FileName,
+		Identity: v.Identity,
 	})
 }
 
@@ -65,100 +180,136 @@ func (sp *SavePos) PatchSave(in []*FIInput) (map[string]*FileInfo, error) {
 			Offset:   v.Offset,
 			AppName:  v.AppName,
 			FileName: v.FileName,
+			Identity: v.Identity,
 		})
 	}
 
-	content, err := json.Marshal(appInfo)
-	if err != nil {
-		level.Error(sp.l).Log("marshal 失败", err)
-		return appInfo, err
+	lock.Lock()
+	values := make(map[string][]byte, len(appInfo))
+	for k, v := range appInfo {
+		content, err := json.Marshal(v)
+		if err != nil {
+			lock.Unlock()
+			level.Error(sp.l).Log("marshal 失败", err)
+			return snapshot(), err
+		}
+		values[k] = content
 	}
+	lock.Unlock()
 
-	level.Info(sp.l).Log("save file content", string(content))
-	err = sp.SaveFile(content)
-	if err != nil {
+	if err := sp.SaveState(BucketPositions, values); err != nil {
 		level.Error(sp.l).Log("write content in file failed, err", err)
-		return appInfo, err
-	}
-	return appInfo, nil
-}
-
-func (sp *SavePos) SaveFile(content []byte) error {
-	f, err := os.OpenFile(sp.FilePosition, os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		level.Error(sp.l).Log("save file error", err)
-		return err
+		return snapshot(), err
 	}
-	// 关闭文件
-	defer f.Close()
-	_, err = f.Write(content)
-	return err
+	return snapshot(), nil
 }
 
+// Load reads the checkpoints of the store on the first call, later calls return what is kept in memory
 func (sp *SavePos) Load(first bool) map[string]*FileInfo {
 	level.Debug(sp.l).Log("load file first", first)
-	content, err := sp.LoadFile(first)
-	if err != nil {
-		level.Error(sp.l).Log("load file error", err)
-		return appInfo
+	if !first {
+		return snapshot()
 	}
-	level.Info(sp.l).Log("load file content", string(content))
-	var tempInfo map[string]FileInfo
-	err = json.Unmarshal(content, &tempInfo)
+	err := sp.LoadState(BucketPositions, func(key string, value []byte) {
+		var fi FileInfo
+		if err := json.Unmarshal(value, &fi); err != nil {
+			level.Error(sp.l).Log("Unmarshal checkpoint error", err, "key", key)
+			return
+		}
+		// a checkpoint keyed by app name is written again under the key of its file
+		set(&fi)
+	})
 	if err != nil {
-		level.Error(sp.l).Log("Unmarshal file error", err)
-		return appInfo
-	}
-	for _, v := range tempInfo {
-		set(&v)
+		level.Error(sp.l).Log("load file error", err)
 	}
-
-	return appInfo
+	return snapshot()
 }
 
-func (sp *SavePos) LoadFile(first bool) ([]byte, error) {
-	var (
-		f   *os.File
-		err error
-	)
-	f, err = os.OpenFile(sp.FilePosition, os.O_RDONLY, 0666)
+// SaveState writes values as the whole content of bucket, only what changed since the last save reaches the store
+func (sp *SavePos) SaveState(bucket string, values map[string][]byte) error {
+	sp.savedLock.Lock()
+	defer sp.savedLock.Unlock()
 
-	if errors.Is(err, os.ErrNotExist) {
-		f, err = os.Create(sp.FilePosition)
+	saved := sp.saved[bucket]
+	changed := make(map[string][]byte)
+	for k, v := range values {
+		if old, ok := saved[k]; !ok || old != string(v) {
+			changed[k] = v
+		}
 	}
-	if err != nil {
-		level.Error(sp.l).Log("load file error", err)
-		if first {
-			panic(err)
+	for k := range saved {
+		if _, ok := values[k]; !ok {
+			changed[k] = nil
 		}
-		return nil, err
 	}
-	defer f.Close()
+	if len(changed) == 0 {
+		return nil
+	}
+	level.Debug(sp.l).Log("save bucket", bucket, "changed", len(changed))
+	if err := sp.store.Save(bucket, changed); err != nil {
+		return err
+	}
+	if saved == nil {
+		saved = make(map[string]string, len(changed))
+		sp.saved[bucket] = saved
+	}
+	for k, v := range changed {
+		if v == nil {
+			delete(saved, k)
+			continue
+		}
+		saved[k] = string(v)
+	}
+	return nil
+}
 
-	nr := bufio.NewReader(f)
-	var chunk []byte
-	buf := make([]byte, 1024)
-	for {
-		n, err := nr.Read(buf)
-		if err != nil {
-			if n == 0 {
-				break
-			}
-			if errors.Is(err, io.EOF) {
-				break
-			} else {
-				level.Error(sp.l).Log("read line error", err)
-				return nil, err
-			}
+// LoadState calls f with every value of bucket in the store
+func (sp *SavePos) LoadState(bucket string, f func(key string, value []byte)) error {
+	sp.savedLock.Lock()
+	defer sp.savedLock.Unlock()
+
+	saved := make(map[string]string)
+	sp.saved[bucket] = saved
+	return sp.store.Load(bucket, func(key string, value []byte) {
+		saved[key] = string(value)
+		f(key, value)
+	})
+}
+
+func (sp *SavePos) Close() error {
+	err := sp.store.Close()
+	sp.lock.Close()
+	return err
+}
+
+// Delete drops the checkpoints f returns true for, they are gone from the store on the next PatchSave
+func (sp *SavePos) Delete(f func(fi *FileInfo) bool) int {
+	lock.Lock()
+	defer lock.Unlock()
+	n := 0
+	for k, v := range appInfo {
+		if f(v) {
+			remove(k)
+			n++
 		}
-		chunk = append(chunk, buf[:n]...)
+	}
+	return n
+}
 
+func snapshot() map[string]*FileInfo {
+	lock.Lock()
+	defer lock.Unlock()
+	s := make(map[string]*FileInfo, len(appInfo))
+	for k, v := range appInfo {
+		fi := *v
+		s[k] = &fi
 	}
-	return chunk, nil
+	return s
 }
 
 type FileInfo struct {
 	Offset   int64  `json:"offset,omitempty"`
 	AppName  string `json:"appName,omitempty"`
 	FileName string `json:"fileName,omitempty"`
+	identity.Identity
 }
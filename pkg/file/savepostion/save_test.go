@@ -0,0 +1,123 @@
+package savepostion
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/identity"
+)
+
+// reset forgets the checkpoints another test left
+func reset() {
+	lock.Lock()
+	defer lock.Unlock()
+	appInfo = make(map[string]*FileInfo)
+	byName = make(map[string]string)
+	byInode = make(map[inode]string)
+}
+
+func writeLog(t *testing.T, fileName, content string, flag int) identity.Identity {
+	t.Helper()
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|flag, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	id, err := identity.OfFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestLookupSameFile(t *testing.T) {
+	reset()
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	id := writeLog(t, fileName, "a\nb\n", 0)
+	set(&FileInfo{FileName: fileName, Offset: 4, AppName: "app", Identity: id})
+
+	if fi, same := Lookup(fileName); fi == nil || !same || fi.Offset != 4 {
+		t.Fatalf("lookup %+v %v", fi, same)
+	}
+}
+
+func TestLookupRenamed(t *testing.T) {
+	reset()
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "app.log")
+	id := writeLog(t, fileName, "a\nb\n", 0)
+	set(&FileInfo{FileName: fileName, Offset: 4, AppName: "app", Identity: id})
+
+	// rotated while the exporter was down
+	if err := os.Rename(fileName, fileName+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeLog(t, fileName, "c\n", 0)
+	fi, same := Lookup(fileName)
+	if fi == nil || same || fi.Offset != 4 {
+		t.Fatalf("lookup %+v %v", fi, same)
+	}
+
+	// the renamed file is known by its inode under its new name
+	if fi, same := Lookup(fileName + ".1"); fi == nil || !same || fi.Offset != 4 {
+		t.Fatalf("lookup renamed %+v %v", fi, same)
+	}
+}
+
+func TestLookupGrownFile(t *testing.T) {
+	reset()
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	small := writeLog(t, fileName, "a\n", 0)
+	set(&FileInfo{FileName: fileName, Offset: 2, AppName: "app", Identity: small})
+
+	// the head of a file under HeadSize grows with the file
+	grown := writeLog(t, fileName, strings.Repeat("b\n", identity.HeadSize), os.O_APPEND)
+	if fi, same := Lookup(fileName); fi == nil || !same || fi.Offset != 2 {
+		t.Fatalf("lookup %+v %v", fi, same)
+	}
+
+	// saved under the new key, the old checkpoint is gone
+	set(&FileInfo{FileName: fileName, Offset: 100, AppName: "app", Identity: grown})
+	if s := snapshot(); len(s) != 1 || s[Key(fileName, grown)] == nil {
+		t.Fatalf("checkpoints %v", s)
+	}
+	if Get(Key(fileName, small)) != nil {
+		t.Fatal("checkpoint of the small file kept")
+	}
+}
+
+func TestLookupWithoutIdentity(t *testing.T) {
+	reset()
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	id := writeLog(t, fileName, "a\n", 0)
+
+	// written before checkpoints had an identity
+	set(&FileInfo{FileName: fileName, Offset: 2, AppName: "app"})
+	if fi, same := Lookup(fileName); fi == nil || !same {
+		t.Fatalf("lookup %+v %v", fi, same)
+	}
+
+	// a checkpoint without identity keeps the one the file has
+	set(&FileInfo{FileName: fileName, Offset: 1, AppName: "app", Identity: id})
+	set(&FileInfo{FileName: fileName, Offset: 2, AppName: "app"})
+	if fi, _ := Lookup(fileName); fi == nil || fi.Identity != id || fi.Offset != 2 {
+		t.Fatalf("lookup %+v", fi)
+	}
+	if s := snapshot(); len(s) != 1 {
+		t.Fatalf("checkpoints %v", s)
+	}
+}
+
+func TestLookupUnknown(t *testing.T) {
+	reset()
+	fileName := filepath.Join(t.TempDir(), "app.log")
+	writeLog(t, fileName, "a\n", 0)
+	if fi, same := Lookup(fileName); fi != nil || same {
+		t.Fatalf("lookup %+v %v", fi, same)
+	}
+}
@@ -0,0 +1,92 @@
+package savepostion
+
+import (
+	"errors"
+	"os"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/kv"
+)
+
+const (
+	StoreJson = "json"
+	StoreKV   = "kv"
+
+	BucketPositions = "positions"
+
+	// the kv store sits next to the json file it takes over from
+	kvSuffix = ".kv"
+)
+
+// StoreInterface keeps the checkpoints and whatever else has to survive a restart, by bucket
+type StoreInterface interface {
+	// Load calls f with every value of bucket
+	Load(bucket string, f func(key string, value []byte)) error
+	// Save writes values to bucket, a nil value deletes its key
+	Save(bucket string, values map[string][]byte) error
+	Close() error
+}
+
+func newStore(kind, fileName string, l log.Logger) (StoreInterface, error) {
+	switch kind {
+	case "", StoreJson:
+		return newJsonStore(fileName, l)
+	case StoreKV:
+		return newKVStore(fileName, l)
+	default:
+		return nil, errors.New("unknown position store " + kind)
+	}
+}
+
+// kvStore writes only the values that changed, to an append only log
+type kvStore struct {
+	db kv.DBInterface
+}
+
+func newKVStore(fileName string, l log.Logger) (*kvStore, error) {
+	db, err := kv.Open(fileName + kvSuffix)
+	if err != nil {
+		return nil, err
+	}
+	ks := &kvStore{db: db}
+
+	// the json file of an earlier run is carried over until there are positions of its own
+	empty := true
+	db.Range(BucketPositions, func(string, []byte) {
+		empty = false
+	})
+	if _, err := os.Stat(fileName); !empty || err != nil {
+		return ks, nil
+	}
+	js, err := newJsonStore(fileName, l)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	for bucket := range js.data {
+		values := make(map[string][]byte, len(js.data[bucket]))
+		js.Load(bucket, func(key string, value []byte) {
+			values[key] = value
+		})
+		if err := db.Write(bucket, values); err != nil {
+			db.Close()
+			return nil, err
+		}
+		level.Info(l).Log("carried over from position file", fileName, "bucket", bucket, "values", len(values))
+	}
+	return ks, nil
+}
+
+func (ks *kvStore) Load(bucket string, f func(key string, value []byte)) error {
+	ks.db.Range(bucket, f)
+	return nil
+}
+
+func (ks *kvStore) Save(bucket string, values map[string][]byte) error {
+	return ks.db.Write(bucket, values)
+}
+
+func (ks *kvStore) Close() error {
+	return ks.db.Close()
+}
@@ -2,23 +2,25 @@ package scan
 
 import "sync"
 
-var oldDir []string
+var (
+	oldDir []string
+	// oldDir is shared by every dirsCheck
+	dirLock sync.Mutex
+)
 
-type dirsCheck struct {
-	l sync.Mutex
-}
+type dirsCheck struct{}
 
 func NewDirs() *dirsCheck {
 	return &dirsCheck{}
 }
 func (dc *dirsCheck) Get() []string {
-	dc.l.Lock()
-	defer dc.l.Unlock()
+	dirLock.Lock()
+	defer dirLock.Unlock()
 	return oldDir
 }
 
 func (dc *dirsCheck) Set(in []string) {
-	dc.l.Lock()
-	defer dc.l.Unlock()
+	dirLock.Lock()
+	defer dirLock.Unlock()
 	oldDir = in
 }
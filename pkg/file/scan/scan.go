@@ -38,11 +38,7 @@ func checkDir(l log.Logger, expectTime time.Time, fileDirs map[string]string, f
 	if len(checkDirs) > 0 {
 		dir := checkDirs[len(checkDirs)-1]
 		dirs = append(dirs, dir)
-
-		if check.Get(dir) == nil {
-			// insert dir_key = appname
-			check.InsertWithClear(check.KeyAppName(dir), fileDirs[dir])
-		}
+		check.SetAppName(dir, fileDirs[dir])
 	}
 	return dirs
 }
@@ -68,7 +64,11 @@ func (s *scan) ScanDir(l log.Logger, flush *FlushPolicy) []string {
 	expectTime := time.Now().Add(-time.Minute * time.Duration(s.ExpectDuration))
 	result := make(map[string]string, len(flush.FileDir))
 	for _, v := range flush.FileDir {
-		appName := check.Get(check.KeyAppName(v))
+		appName, ok := check.AppOfPattern(v)
+		if !ok {
+			level.Warn(l).Log("no app of log dir, path", v)
+			continue
+		}
 		if strings.Contains(v, "*") {
 			matchs, err := filepath.Glob(v)
 			if err != nil {
@@ -76,10 +76,10 @@ func (s *scan) ScanDir(l log.Logger, flush *FlushPolicy) []string {
 				continue
 			}
 			for _, m := range matchs {
-				result[m] = appName.(string)
+				result[m] = appName
 			}
 		} else {
-			result[v] = appName.(string)
+			result[v] = appName
 		}
 	}
 	level.Debug(l).Log("scaning dir", result)
@@ -0,0 +1,83 @@
+package fingerprint
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"time"
+)
+
+// the parts of a line that change between repeats of the same problem, masked in this order
+var masks = []struct {
+	reg  *regexp.Regexp
+	with string
+}{
+	{regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b|\b(?:[0-9a-fA-F]{1,4}:){1,6}:[0-9a-fA-F]{1,4}(?::[0-9a-fA-F]{1,4})*\b`), "<ip>"},
+	{regexp.MustCompile(`\b0[xX][0-9a-fA-F]+\b|\b[0-9a-fA-F]{8,}\b`), "<hex>"},
+	{regexp.MustCompile(`\d+(?:\.\d+)?`), "<num>"},
+}
+
+// Mask replaces the uuids, ips, hex strings and numbers of text
+func Mask(text string) string {
+	for _, m := range masks {
+		text = m.reg.ReplaceAllString(text, m.with)
+	}
+	return text
+}
+
+// Sum is the fingerprint of text, lines differing only in what Mask hides have the same one
+func Sum(text string) string {
+	h := fnv.New64a()
+	h.Write([]byte(Mask(text)))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// DedupeInterface collapses the repeats of a key within a window into one event
+type DedupeInterface interface {
+	// Add records a repeat of key, emit is kept from the first one of the window
+	Add(key string, now time.Time, emit func(count int))
+	// Flush emits the events whose window is over, all of them when now is zero
+	Flush(now time.Time)
+}
+
+type pending struct {
+	start time.Time
+	count int
+	emit  func(count int)
+}
+
+// Dedupe is owned by one tailer and not safe for concurrent use
+type Dedupe struct {
+	Window  time.Duration
+	pending map[string]*pending
+}
+
+func NewDedupe(window time.Duration) DedupeInterface {
+	return &Dedupe{
+		Window:  window,
+		pending: make(map[string]*pending),
+	}
+}
+
+func (d *Dedupe) Add(key string, now time.Time, emit func(count int)) {
+	if p, ok := d.pending[key]; ok {
+		if now.Sub(p.start) < d.Window {
+			p.count++
+			return
+		}
+		p.emit(p.count)
+	}
+	d.pending[key] = &pending{start: now, count: 1, emit: emit}
+}
+
+func (d *Dedupe) Flush(now time.Time) {
+	for k, p := range d.pending {
+		if !now.IsZero() && now.Sub(p.start) < d.Window {
+			continue
+		}
+		delete(d.pending, k)
+		p.emit(p.count)
+	}
+}
@@ -0,0 +1,345 @@
+package kv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	magic = "KWKV1\n"
+
+	// every write appends a record, the file is rewritten with only the live values
+	// once it is over compactSize and more than half of it is overwritten values
+	compactSize = 1 << 20
+
+	recordHeader = 8
+	// a length over it is a damaged header, not a record
+	maxRecord = 1 << 28
+)
+
+var ErrNotKV = errors.New("not a kv file")
+
+type DBInterface interface {
+	Get(bucket, key string) ([]byte, bool)
+	// Range calls f in key order
+	Range(bucket string, f func(key string, value []byte))
+	// Write puts the values of bucket and deletes the keys of nil values, all or nothing
+	Write(bucket string, values map[string][]byte) error
+	Close() error
+}
+
+// DB is an append only log of writes, read into memory when it is opened
+type DB struct {
+	path string
+	lock sync.Mutex
+	f    *os.File
+	data map[string]map[string][]byte
+	// bytes in the file and bytes a compacted file would take
+	size int64
+	live int64
+}
+
+func Open(path string) (DBInterface, error) {
+	db := &DB{
+		path: path,
+		data: make(map[string]map[string][]byte),
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	db.f = f
+	if err := db.replay(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if db.size > compactSize && db.size > 2*db.live {
+		if err := db.compact(); err != nil {
+			db.f.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// replay reads the records of the file, a record cut short by a crash and what follows it is dropped
+func (db *DB) replay() error {
+	info, err := db.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := db.f.Write([]byte(magic)); err != nil {
+			return err
+		}
+		db.size = int64(len(magic))
+		db.live = db.size
+		return db.f.Sync()
+	}
+
+	r := bufio.NewReader(db.f)
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, head); err != nil || string(head) != magic {
+		return fmt.Errorf("%w: %s", ErrNotKV, db.path)
+	}
+	good := int64(len(magic))
+	for {
+		body, err := readRecord(r)
+		if err != nil {
+			break
+		}
+		bucket, values, err := decode(body)
+		if err != nil {
+			break
+		}
+		db.apply(bucket, values)
+		good += recordHeader + int64(len(body))
+	}
+	if good < info.Size() {
+		if err := db.f.Truncate(good); err != nil {
+			return err
+		}
+	}
+	if _, err := db.f.Seek(good, io.SeekStart); err != nil {
+		return err
+	}
+	db.size = good
+	return nil
+}
+
+func readRecord(r io.Reader) ([]byte, error) {
+	head := make([]byte, recordHeader)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(head)
+	if size > maxRecord {
+		return nil, errors.New("record too long")
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(head[4:]) {
+		return nil, errors.New("record checksum mismatch")
+	}
+	return body, nil
+}
+
+func (db *DB) apply(bucket string, values map[string][]byte) {
+	b := db.data[bucket]
+	if b == nil {
+		b = make(map[string][]byte, len(values))
+		db.data[bucket] = b
+	}
+	for k, v := range values {
+		if old, ok := b[k]; ok {
+			db.live -= entrySize(bucket, k, old)
+		}
+		if v == nil {
+			delete(b, k)
+			continue
+		}
+		b[k] = v
+		db.live += entrySize(bucket, k, v)
+	}
+}
+
+// entrySize is about what an entry takes in a compacted file
+func entrySize(bucket, key string, value []byte) int64 {
+	return int64(recordHeader + len(bucket) + len(key) + len(value) + 3*binary.MaxVarintLen32)
+}
+
+func (db *DB) Get(bucket, key string) ([]byte, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	v, ok := db.data[bucket][key]
+	return v, ok
+}
+
+func (db *DB) Range(bucket string, f func(key string, value []byte)) {
+	db.lock.Lock()
+	b := db.data[bucket]
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	values := make([][]byte, len(keys))
+	sort.Strings(keys)
+	for i, k := range keys {
+		values[i] = b[k]
+	}
+	db.lock.Unlock()
+
+	for i, k := range keys {
+		f(k, values[i])
+	}
+}
+
+func (db *DB) Write(bucket string, values map[string][]byte) error {
+	if len(values) == 0 {
+		return nil
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.f == nil {
+		return os.ErrClosed
+	}
+
+	record := encodeRecord(bucket, values)
+	if _, err := db.f.Write(record); err != nil {
+		// a torn record is dropped by the next replay, so is anything written after it
+		db.f.Truncate(db.size)
+		db.f.Seek(db.size, io.SeekStart)
+		return err
+	}
+	if err := db.f.Sync(); err != nil {
+		return err
+	}
+	db.size += int64(len(record))
+	db.apply(bucket, values)
+	if db.size > compactSize && db.size > 2*db.live {
+		return db.compact()
+	}
+	return nil
+}
+
+// compact writes the live values to a new file and puts it in place of the log
+func (db *DB) compact() error {
+	temp := db.path + ".tmp"
+	f, err := os.OpenFile(temp, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	size := int64(len(magic))
+	_, err = f.Write([]byte(magic))
+	for bucket, b := range db.data {
+		if err != nil || len(b) == 0 {
+			continue
+		}
+		record := encodeRecord(bucket, b)
+		_, err = f.Write(record)
+		size += int64(len(record))
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(temp, db.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(temp)
+		return err
+	}
+	if d, err := os.Open(filepath.Dir(db.path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	db.f.Close()
+	db.f = f
+	db.size = size
+	return nil
+}
+
+func (db *DB) Close() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.f == nil {
+		return nil
+	}
+	err := db.f.Close()
+	db.f = nil
+	return err
+}
+
+// a record is the length and crc32 of its body, the body is the bucket and every key with
+// a flag telling a put from a delete and the value of a put
+func encodeRecord(bucket string, values map[string][]byte) []byte {
+	body := make([]byte, 0, 64)
+	body = appendString(body, bucket)
+	body = binary.AppendUvarint(body, uint64(len(values)))
+	for k, v := range values {
+		body = appendString(body, k)
+		if v == nil {
+			body = append(body, 0)
+			continue
+		}
+		body = append(body, 1)
+		body = appendString(body, string(v))
+	}
+	record := make([]byte, recordHeader, recordHeader+len(body))
+	binary.LittleEndian.PutUint32(record, uint32(len(body)))
+	binary.LittleEndian.PutUint32(record[4:], crc32.ChecksumIEEE(body))
+	return append(record, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func decode(body []byte) (string, map[string][]byte, error) {
+	d := &decoder{b: body}
+	bucket := d.string()
+	n := d.uvarint()
+	values := make(map[string][]byte, n)
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		k := d.string()
+		if d.byte() == 0 {
+			values[k] = nil
+			continue
+		}
+		values[k] = []byte(d.string())
+	}
+	return bucket, values, d.err
+}
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+var errShort = errors.New("record is cut short")
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = errShort
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.b) == 0 {
+		d.err = errShort
+		return 0
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil || uint64(len(d.b)) < n {
+		d.err = errShort
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
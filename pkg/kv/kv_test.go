@@ -0,0 +1,203 @@
+package kv
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func open(t *testing.T, path string) DBInterface {
+	t.Helper()
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func write(t *testing.T, db DBInterface, bucket string, values map[string]string) {
+	t.Helper()
+	v := make(map[string][]byte, len(values))
+	for key, value := range values {
+		v[key] = []byte(value)
+	}
+	if err := db.Write(bucket, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectBucket(t *testing.T, db DBInterface, bucket string, want map[string]string) {
+	t.Helper()
+	got := make(map[string]string)
+	db.Range(bucket, func(key string, value []byte) {
+		got[key] = string(value)
+	})
+	if len(got) != len(want) {
+		t.Fatalf("bucket %s is %v, want %v", bucket, got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("bucket %s is %v, want %v", bucket, got, want)
+		}
+	}
+}
+
+func appendFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func size(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestWriteAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db := open(t, path)
+	write(t, db, "a", map[string]string{"x": "1", "y": "2"})
+	write(t, db, "b", map[string]string{"x": "3"})
+	if err := db.Write("a", map[string][]byte{"y": nil, "z": []byte("4")}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = open(t, path)
+	expectBucket(t, db, "a", map[string]string{"x": "1", "z": "4"})
+	expectBucket(t, db, "b", map[string]string{"x": "3"})
+	if v, ok := db.Get("b", "x"); !ok || string(v) != "3" {
+		t.Fatalf("get %q %v", v, ok)
+	}
+	if _, ok := db.Get("a", "y"); ok {
+		t.Fatal("deleted key found")
+	}
+}
+
+func TestNotKV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	if err := os.WriteFile(path, []byte(`{"version":2}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); !errors.Is(err, ErrNotKV) {
+		t.Fatalf("open a json file, err %v", err)
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	for _, cut := range []int{1, recordHeader, recordHeader + 3} {
+		t.Run(strconv.Itoa(cut), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "db")
+			db := open(t, path)
+			write(t, db, "a", map[string]string{"x": "1"})
+			db.Close()
+			good := size(t, path)
+
+			// a crash in the middle of the next write
+			appendFile(t, path, encodeRecord("a", map[string][]byte{"x": []byte("2")})[:cut])
+			db = open(t, path)
+			expectBucket(t, db, "a", map[string]string{"x": "1"})
+			if got := size(t, path); got != good {
+				t.Fatalf("size %d after replay, want %d", got, good)
+			}
+
+			// the next write follows the last good record
+			write(t, db, "a", map[string]string{"y": "3"})
+			db.Close()
+			expectBucket(t, open(t, path), "a", map[string]string{"x": "1", "y": "3"})
+		})
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db := open(t, path)
+	write(t, db, "a", map[string]string{"x": "1"})
+	good := size(t, path)
+	write(t, db, "a", map[string]string{"x": "2"})
+	write(t, db, "a", map[string]string{"y": "3"})
+	db.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the value is the last byte of the second record
+	i := good + int64(len(encodeRecord("a", map[string][]byte{"x": []byte("2")}))) - 1
+	if data[i] != '2' {
+		t.Fatalf("byte %q is not the value", data[i])
+	}
+	data[i] = '9'
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// the damaged record and what follows it are dropped, a value written before them is kept
+	db = open(t, path)
+	expectBucket(t, db, "a", map[string]string{"x": "1"})
+	if got := size(t, path); got != good {
+		t.Fatalf("size %d after replay, want %d", got, good)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db := open(t, path)
+	value := string(bytes.Repeat([]byte("v"), 1024))
+	write(t, db, "b", map[string]string{"kept": "1"})
+	for i := 0; i < 2000; i++ {
+		write(t, db, "a", map[string]string{"x": value + strconv.Itoa(i)})
+		if size(t, path) > 2*compactSize {
+			t.Fatalf("not compacted after %d writes", i)
+		}
+	}
+	db.Close()
+
+	db = open(t, path)
+	expectBucket(t, db, "a", map[string]string{"x": value + "1999"})
+	expectBucket(t, db, "b", map[string]string{"kept": "1"})
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temp file left, err %v", err)
+	}
+}
+
+func TestCompactOnOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db := open(t, path)
+	write(t, db, "a", map[string]string{"x": "0"})
+	db.Close()
+
+	// overwritten values left by a run that stopped before compacting
+	value := bytes.Repeat([]byte("v"), 1024)
+	var records []byte
+	for len(records) <= compactSize {
+		records = append(records, encodeRecord("a", map[string][]byte{"x": value})...)
+	}
+	appendFile(t, path, records)
+	appendFile(t, path, encodeRecord("a", map[string][]byte{"x": []byte("last")}))
+
+	db = open(t, path)
+	if got := size(t, path); got > compactSize {
+		t.Fatalf("size %d after open, not compacted", got)
+	}
+	expectBucket(t, db, "a", map[string]string{"x": "last"})
+
+	// the compacted file is the one written to from now on
+	write(t, db, "a", map[string]string{"y": "1"})
+	db.Close()
+	expectBucket(t, open(t, path), "a", map[string]string{"x": "last", "y": "1"})
+}
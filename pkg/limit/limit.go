@@ -2,6 +2,7 @@ package limit
 
 import (
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,6 +11,13 @@ import (
 	"golang.org/x/time/rate"
 )
 
+const keySep = "\x00"
+
+// Key limits a keyword of a file on its own, RangeDelete still clears it by the file path
+func Key(filePath, keyWord string) string {
+	return filePath + keySep + keyWord
+}
+
 func (ls *LimitSend) newLimit(path string) {
 	ls.lock.Lock()
 	ls.limit[path] = rate.NewLimiter(rate.Every(time.Second*60), 1)
@@ -102,7 +110,7 @@ func (ls *LimitSend) RangeDelete(list []string) {
 	for k := range ls.limit {
 		get := false
 		for _, l := range list {
-			if k == l {
+			if k == l || strings.HasPrefix(k, l+keySep) {
 				get = true
 				break
 			}
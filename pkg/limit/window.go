@@ -0,0 +1,47 @@
+package limit
+
+import (
+	"sync"
+	"time"
+)
+
+type WindowInterface interface {
+	// Hit records a match of key, fire is true on the match that makes Count within Window,
+	// the count of key starts over after it
+	Hit(key string, now time.Time) (observed int, fire bool)
+}
+
+// Window counts the matches of every key in a sliding window
+type Window struct {
+	Count  int
+	Window time.Duration
+	lock   sync.Mutex
+	hits   map[string][]time.Time
+}
+
+func NewWindow(count int, window time.Duration) WindowInterface {
+	return &Window{
+		Count:  count,
+		Window: window,
+		hits:   make(map[string][]time.Time),
+	}
+}
+
+func (w *Window) Hit(key string, now time.Time) (int, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	hits := w.hits[key]
+	expire := now.Add(-w.Window)
+	i := 0
+	for i < len(hits) && !hits[i].After(expire) {
+		i++
+	}
+	hits = append(hits[i:], now)
+	if len(hits) >= w.Count {
+		delete(w.hits, key)
+		return len(hits), true
+	}
+	w.hits[key] = hits
+	return len(hits), false
+}
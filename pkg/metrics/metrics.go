@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// metrics about the exporter itself, served on app.port/metrics
+var (
+	SuppressedLines = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "keyword_exporter_suppressed_lines_total",
+		Help: "lines matched a keyword but dropped by an exclude keyword, by the first keyword and exclude keyword of the line",
+	}, []string{"app_name", "keywords", "exclude_keywords"})
+
+	LabelOverflow = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "keyword_exporter_label_overflow_total",
+		Help: "label values sent as other because of the allowlist or the distinct value cap",
+	}, []string{"app_name", "label"})
+
+	FileRotations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "keyword_exporter_file_rotations_total",
+		Help: "rotations seen on a followed file, kind is rename, truncate or remove",
+	}, []string{"file_name", "kind"})
+)
@@ -0,0 +1,96 @@
+package tailkeyword
+
+import (
+	"sync"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/metrics"
+)
+
+const (
+	defaultLabelValues = 100
+	// values out of the allowlist or over the cap are sent as this
+	otherLabelValue = "other"
+)
+
+// labelLimit keeps the distinct values of a label of an app under control,
+// the tailers of every file of the app share one
+type labelLimit struct {
+	appName string
+	name    string
+	allow   map[string]struct{}
+	max     int
+	lock    sync.Mutex
+	seen    map[string]struct{}
+}
+
+var (
+	labelLimits = make(map[string]*labelLimit)
+	labelLock   = sync.Mutex{}
+)
+
+func getLabelLimit(appName string, rule conf.LabelRule) *labelLimit {
+	labelLock.Lock()
+	defer labelLock.Unlock()
+
+	key := appName + "\x00" + rule.Name
+	if ll, ok := labelLimits[key]; ok {
+		return ll
+	}
+	ll := &labelLimit{
+		appName: appName,
+		name:    rule.Name,
+		max:     rule.MaxValues,
+		seen:    make(map[string]struct{}),
+	}
+	if ll.max <= 0 {
+		ll.max = defaultLabelValues
+	}
+	if len(rule.Allow) > 0 {
+		ll.allow = make(map[string]struct{}, len(rule.Allow))
+		for _, v := range rule.Allow {
+			ll.allow[v] = struct{}{}
+		}
+	}
+	labelLimits[key] = ll
+	return ll
+}
+
+func (ll *labelLimit) value(v string) string {
+	if ll.allow != nil {
+		if _, ok := ll.allow[v]; ok {
+			return v
+		}
+		metrics.LabelOverflow.WithLabelValues(ll.appName, ll.name).Inc()
+		return otherLabelValue
+	}
+
+	ll.lock.Lock()
+	defer ll.lock.Unlock()
+	if _, ok := ll.seen[v]; ok {
+		return v
+	}
+	if len(ll.seen) >= ll.max {
+		metrics.LabelOverflow.WithLabelValues(ll.appName, ll.name).Inc()
+		return otherLabelValue
+	}
+	ll.seen[v] = struct{}{}
+	return v
+}
+
+// peek is what value returns for v, without keeping v or counting an overflow
+func (ll *labelLimit) peek(v string) string {
+	if ll.allow != nil {
+		if _, ok := ll.allow[v]; ok {
+			return v
+		}
+		return otherLabelValue
+	}
+
+	ll.lock.Lock()
+	defer ll.lock.Unlock()
+	if _, ok := ll.seen[v]; ok || len(ll.seen) < ll.max {
+		return v
+	}
+	return otherLabelValue
+}
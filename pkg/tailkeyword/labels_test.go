@@ -0,0 +1,135 @@
+package tailkeyword
+
+import (
+	"reflect"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/filter"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/metrics"
+)
+
+func overflow(appName, label string) float64 {
+	var m dto.Metric
+	metrics.LabelOverflow.WithLabelValues(appName, label).Write(&m)
+	return m.GetCounter().GetValue()
+}
+
+func TestLabelLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     conf.LabelRule
+		values   []string
+		want     []string
+		overflow float64
+	}{
+		{
+			name:     "allow",
+			rule:     conf.LabelRule{Name: "level", Allow: []string{"error", "warn"}},
+			values:   []string{"error", "debug", "warn", "trace"},
+			want:     []string{"error", "other", "warn", "other"},
+			overflow: 2,
+		},
+		{
+			name:     "cap",
+			rule:     conf.LabelRule{Name: "user", MaxValues: 2},
+			values:   []string{"a", "b", "c", "a", "d", "b"},
+			want:     []string{"a", "b", "other", "a", "other", "b"},
+			overflow: 2,
+		},
+		{
+			name:   "default cap",
+			rule:   conf.LabelRule{Name: "code"},
+			values: []string{"1", "2", "3"},
+			want:   []string{"1", "2", "3"},
+		},
+	}
+	for _, v := range tests {
+		appName := "label-limit-" + v.name
+		ll := getLabelLimit(appName, v.rule)
+		got := make([]string, 0, len(v.values))
+		for _, value := range v.values {
+			got = append(got, ll.value(value))
+		}
+		if !reflect.DeepEqual(got, v.want) {
+			t.Errorf("%s: values %v, want %v", v.name, got, v.want)
+		}
+		if n := overflow(appName, v.rule.Name); n != v.overflow {
+			t.Errorf("%s: overflow %v, want %v", v.name, n, v.overflow)
+		}
+	}
+}
+
+func TestLabelLimitShared(t *testing.T) {
+	rule := conf.LabelRule{Name: "user", MaxValues: 1}
+	ll := getLabelLimit("label-limit-shared", rule)
+	if other := getLabelLimit("label-limit-shared", rule); other != ll {
+		t.Fatal("tailers of one app have their own limit")
+	}
+	if other := getLabelLimit("label-limit-shared-2", rule); other == ll {
+		t.Fatal("apps share a limit")
+	}
+
+	// peek neither keeps a value nor counts an overflow
+	if v := ll.peek("a"); v != "a" {
+		t.Fatalf("peek %q", v)
+	}
+	ll.value("b")
+	if v := ll.peek("a"); v != otherLabelValue {
+		t.Fatalf("peek %q over the cap", v)
+	}
+	if n := overflow("label-limit-shared", "user"); n != 0 {
+		t.Fatalf("overflow %v after peek", n)
+	}
+}
+
+func TestExtraLabels(t *testing.T) {
+	rule := &conf.List{
+		AppName:     "extra-labels",
+		MatchType:   filter.MatchTypeRegex,
+		KeyWords:    []string{`order (?P<order>\d+) failed`, `user (?P<user>\w+) (?P<level>\w+)`},
+		LabelFields: []string{"level"},
+		Labels:      []conf.LabelRule{{Name: "user", Allow: []string{"bob"}}, {Name: "order", MaxValues: 1}},
+	}
+	hf, err := filter.NewHaveFilter(rule.MatchType, rule.KeyWords, rule.ExcludeKeyWords, rule.ResolveKeyWord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := newPipeline(rule, hf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text    string
+		keyWord string
+		fields  map[string]string
+		want    map[string][]string
+	}{
+		{"order 1 failed", rule.KeyWords[0], nil, map[string][]string{"order": {"1"}}},
+		{"order 2 failed", rule.KeyWords[0], nil, map[string][]string{"order": {"other"}}},
+		// a capture group wins over the field of the same name
+		{"user bob error", rule.KeyWords[1], map[string]string{"level": "info"}, map[string][]string{"user": {"bob"}, "level": {"error"}}},
+		{"user eve warn", rule.KeyWords[1], nil, map[string][]string{"user": {"other"}, "level": {"warn"}}},
+		{"order 1 failed", rule.KeyWords[0], map[string]string{"level": "info"}, map[string][]string{"order": {"1"}, "level": {"info"}}},
+	}
+	for _, v := range tests {
+		got := p.extraLabels(v.text, v.keyWord, v.fields, make(map[string][]string))
+		if !reflect.DeepEqual(got, v.want) {
+			t.Errorf("%q: labels %v, want %v", v.text, got, v.want)
+		}
+	}
+}
+
+func TestLabelRuleErrors(t *testing.T) {
+	for _, rule := range []*conf.List{
+		{AppName: "reserved", LabelFields: []string{LabelFingerprint}},
+		{AppName: "reserved", Labels: []conf.LabelRule{{Name: "__name__"}}},
+		{AppName: "reserved", Labels: []conf.LabelRule{{Allow: []string{"a"}}}},
+	} {
+		if err := CheckRule(rule); err == nil {
+			t.Errorf("%+v accepted", rule)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package tailkeyword
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+)
+
+const (
+	defaultContinuePattern = `^(\s|at |Caused by)`
+	defaultMaxLines        = 500
+	defaultFlushTimeout    = 3000
+)
+
+// Multiline joins a stack trace and the line before it into one event
+type Multiline struct {
+	start    *regexp.Regexp
+	cont     *regexp.Regexp
+	maxLines int
+	timeout  time.Duration
+	lines    []string
+	// where the first line of the pending event starts in the file
+	offset int64
+	last   time.Time
+}
+
+func NewMultiline(c *conf.Multiline) (*Multiline, error) {
+	m := &Multiline{
+		maxLines: defaultMaxLines,
+		timeout:  time.Millisecond * defaultFlushTimeout,
+	}
+	var err error
+	if c.StartPattern != "" {
+		if m.start, err = regexp.Compile(c.StartPattern); err != nil {
+			return nil, fmt.Errorf("compile multiline start pattern %q failed: %w", c.StartPattern, err)
+		}
+	}
+	contPattern := defaultContinuePattern
+	if c.ContinuePattern != "" {
+		contPattern = c.ContinuePattern
+	}
+	if m.cont, err = regexp.Compile(contPattern); err != nil {
+		return nil, fmt.Errorf("compile multiline continue pattern %q failed: %w", contPattern, err)
+	}
+	if c.MaxLines > 0 {
+		m.maxLines = c.MaxLines
+	}
+	if c.Timeout > 0 {
+		m.timeout = time.Millisecond * time.Duration(c.Timeout)
+	}
+	return m, nil
+}
+
+func (m *Multiline) isStart(line string) bool {
+	if m.start != nil {
+		return m.start.MatchString(line)
+	}
+	return !m.cont.MatchString(line)
+}
+
+// Push adds a line starting at offset, it returns the previous event and its offset once line begins a new one or the event is full
+func (m *Multiline) Push(line string, offset int64, now time.Time) (string, int64, bool) {
+	m.last = now
+	if m.isStart(line) || len(m.lines) == 0 {
+		event, eventOffset, ok := m.Flush()
+		m.lines = append(m.lines, line)
+		m.offset = offset
+		return event, eventOffset, ok
+	}
+	m.lines = append(m.lines, line)
+	if len(m.lines) >= m.maxLines {
+		return m.Flush()
+	}
+	return "", 0, false
+}
+
+// Expired reports a pending event nobody appended to within the flush timeout
+func (m *Multiline) Expired(now time.Time) bool {
+	return len(m.lines) > 0 && now.Sub(m.last) >= m.timeout
+}
+
+func (m *Multiline) Flush() (string, int64, bool) {
+	if len(m.lines) == 0 {
+		return "", 0, false
+	}
+	event := strings.Join(m.lines, "\n")
+	m.lines = m.lines[:0]
+	return event, m.offset, true
+}
+
+func (m *Multiline) tick() time.Duration {
+	tick := m.timeout / 2
+	if tick < time.Millisecond*100 {
+		tick = time.Millisecond * 100
+	}
+	return tick
+}
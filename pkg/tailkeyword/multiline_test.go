@@ -0,0 +1,115 @@
+package tailkeyword
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+)
+
+type event struct {
+	Text   string
+	Offset int64
+}
+
+func TestMultiline(t *testing.T) {
+	tests := []struct {
+		name  string
+		c     conf.Multiline
+		lines []string
+		// the events pushed out, the pending one is flushed last
+		want []event
+	}{
+		{
+			name:  "java stack",
+			lines: []string{"error a", "\tat x.y", "Caused by: z", "info b"},
+			want:  []event{{"error a\n\tat x.y\nCaused by: z", 0}, {"info b", 29}},
+		},
+		{
+			name:  "single lines",
+			lines: []string{"a", "b"},
+			want:  []event{{"a", 0}, {"b", 2}},
+		},
+		{
+			name:  "continuation first",
+			lines: []string{"  orphan", "a"},
+			want:  []event{{"  orphan", 0}, {"a", 9}},
+		},
+		{
+			name:  "start pattern",
+			c:     conf.Multiline{StartPattern: `^\d{4}-`},
+			lines: []string{"2026-10-18 error", "panic: x", "goroutine 1", "2026-10-18 info"},
+			want:  []event{{"2026-10-18 error\npanic: x\ngoroutine 1", 0}, {"2026-10-18 info", 38}},
+		},
+		{
+			name:  "continue pattern",
+			c:     conf.Multiline{ContinuePattern: `^\+`},
+			lines: []string{"a", "+b", " c"},
+			want:  []event{{"a\n+b", 0}, {" c", 5}},
+		},
+		{
+			name:  "max lines",
+			c:     conf.Multiline{MaxLines: 2},
+			lines: []string{"a", " b", " c", "d"},
+			want:  []event{{"a\n b", 0}, {" c", 5}, {"d", 8}},
+		},
+	}
+	now := time.Now()
+	for _, v := range tests {
+		m, err := NewMultiline(&v.c)
+		if err != nil {
+			t.Fatalf("%s: %v", v.name, err)
+		}
+		var got []event
+		var offset int64
+		for _, line := range v.lines {
+			if text, o, ok := m.Push(line, offset, now); ok {
+				got = append(got, event{text, o})
+			}
+			offset += int64(len(line)) + 1
+		}
+		if text, o, ok := m.Flush(); ok {
+			got = append(got, event{text, o})
+		}
+		if !reflect.DeepEqual(got, v.want) {
+			t.Errorf("%s: events %q, want %q", v.name, got, v.want)
+		}
+		if _, _, ok := m.Flush(); ok {
+			t.Errorf("%s: flushed twice", v.name)
+		}
+	}
+}
+
+func TestMultilineExpired(t *testing.T) {
+	m, err := NewMultiline(&conf.Multiline{Timeout: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if m.Expired(now.Add(time.Hour)) {
+		t.Fatal("nothing pending expired")
+	}
+	m.Push("error", 0, now)
+	m.Push("\tat x", 6, now.Add(time.Millisecond*50))
+	if m.Expired(now.Add(time.Millisecond * 140)) {
+		t.Fatal("expired within the timeout of the last line")
+	}
+	if !m.Expired(now.Add(time.Millisecond * 150)) {
+		t.Fatal("not expired after the timeout")
+	}
+	if text, offset, ok := m.Flush(); !ok || text != "error\n\tat x" || offset != 0 {
+		t.Fatalf("flushed %q %d %v", text, offset, ok)
+	}
+	if m.Expired(now.Add(time.Hour)) {
+		t.Fatal("expired after flush")
+	}
+}
+
+func TestMultilineBadPattern(t *testing.T) {
+	for _, c := range []conf.Multiline{{StartPattern: "("}, {ContinuePattern: "["}} {
+		if _, err := NewMultiline(&c); err == nil {
+			t.Errorf("%+v accepted", c)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package tailkeyword
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/filter"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/parse"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/fingerprint"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/limit"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/tsdb"
+)
+
+// pipeline is what a tailer compiles once from its rule
+type pipeline struct {
+	hf     filter.HaveFilterInterface[string]
+	parser parse.ParserInterface
+	fields *filter.FieldFilter
+	labels []*labelLimit
+	value  *valueRule
+	// nil when every match is sent
+	threshold limit.WindowInterface
+	// nil when samples take the time the line is read
+	timestamp *timestampRule
+	// nil when lines are not fingerprinted
+	fingerprint *labelLimit
+	// nil when every match is sent
+	dedupe fingerprint.DedupeInterface
+}
+
+// LabelFingerprint is the hash of a matched line with its ids and numbers masked
+const LabelFingerprint = "fingerprint"
+
+func newPipeline(rule *conf.List, hf filter.HaveFilterInterface[string]) (*pipeline, error) {
+	p := &pipeline{
+		hf:     hf,
+		labels: make([]*labelLimit, 0, len(rule.LabelFields)+len(rule.Labels)),
+	}
+	for _, v := range rule.LabelFields {
+		if err := checkLabelName(v); err != nil {
+			return nil, err
+		}
+		p.labels = append(p.labels, getLabelLimit(rule.AppName, conf.LabelRule{Name: v}))
+	}
+	for _, v := range rule.Labels {
+		if v.Name == "" {
+			return nil, fmt.Errorf("label rule %+v has no name", v)
+		}
+		if err := checkLabelName(v.Name); err != nil {
+			return nil, err
+		}
+		p.labels = append(p.labels, getLabelLimit(rule.AppName, v))
+	}
+	var err error
+	if p.parser, err = parse.NewParser(rule); err != nil {
+		return nil, err
+	}
+	if rule.Value != nil {
+		if p.value, err = newValueRule(rule.Value); err != nil {
+			return nil, err
+		}
+	}
+	if rule.Timestamp != nil {
+		if p.timestamp, err = newTimestampRule(rule.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+	if rule.Fingerprint != nil {
+		p.fingerprint = getLabelLimit(rule.AppName, conf.LabelRule{Name: LabelFingerprint, MaxValues: rule.Fingerprint.MaxValues})
+		if rule.Fingerprint.Window > 0 {
+			p.dedupe = fingerprint.NewDedupe(time.Second * time.Duration(rule.Fingerprint.Window))
+		}
+	}
+	if rule.Threshold != nil {
+		if rule.Threshold.Count <= 0 || rule.Threshold.Window <= 0 {
+			return nil, fmt.Errorf("threshold %+v needs a count and a window", *rule.Threshold)
+		}
+		p.threshold = limit.NewWindow(rule.Threshold.Count, time.Second*time.Duration(rule.Threshold.Window))
+	}
+	if len(rule.Fields) > 0 {
+		if p.fields, err = filter.NewFieldFilter(rule.Fields); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// checkLabelName refuses a label taken from lines that has the name of a label the exporter sends
+func checkLabelName(name string) error {
+	if n := tsdb.LabelName(name); tsdb.ReservedLabel(n) || n == LabelFingerprint {
+		return fmt.Errorf("label %q is sent by the exporter itself, it cannot be taken from lines", name)
+	}
+	return nil
+}
+
+// CheckRule builds everything a tailer of rule needs, so a bad config fails at startup
+func CheckRule(rule *conf.List) error {
+	hf, err := filter.NewHaveFilter(rule.MatchType, rule.KeyWords, rule.ExcludeKeyWords, rule.ResolveKeyWord)
+	if err != nil {
+		return err
+	}
+	if rule.Multiline != nil {
+		if _, err := NewMultiline(rule.Multiline); err != nil {
+			return err
+		}
+	}
+	_, err = newPipeline(rule, hf)
+	return err
+}
+
+// parse fails when the line is not in the format of the rule
+func (p *pipeline) parse(text string) (map[string]string, error) {
+	if p.parser == nil {
+		return nil, nil
+	}
+	return p.parser.Parse(text)
+}
+
+func (p *pipeline) find(text string, keyWord []string, fields map[string]string) []string {
+	if p.fields != nil {
+		if !p.fields.Match(fields) {
+			return nil
+		}
+		if len(keyWord) == 0 {
+			return []string{p.fields.String()}
+		}
+	}
+	return p.filter(text, filter.ListKeyWords, keyWord)
+}
+
+// valueOnly is a rule with a value and nothing to match, its value is taken from every line
+func (p *pipeline) valueOnly(keyWord []string) bool {
+	return p.value != nil && p.fields == nil && len(keyWord) == 0
+}
+
+// filter finds the keywords of keyWord in text, list is the list of NewHaveFilter keyWord is
+func (p *pipeline) filter(text string, list int, keyWord []string) []string {
+	if lf, ok := p.hf.(filter.ListFilterInterface); ok {
+		return lf.HaveFilterList(text, list)
+	}
+	return p.hf.HaveFilter(text, keyWord)
+}
+
+// extraLabels adds the labels of the rule, a named capture group of keyWord wins over a field of the same name
+func (p *pipeline) extraLabels(text, keyWord string, fields map[string]string, other map[string][]string) map[string][]string {
+	if len(p.labels) == 0 && p.fingerprint == nil {
+		return other
+	}
+	var captures map[string]string
+	if cf, ok := p.hf.(filter.CaptureFilterInterface); ok {
+		captures = cf.Captures(text, keyWord)
+	}
+	if p.fingerprint != nil {
+		other[LabelFingerprint] = []string{p.fingerprint.value(fingerprint.Sum(text))}
+	}
+	for _, ll := range p.labels {
+		value, ok := captures[ll.name]
+		if !ok {
+			value, ok = fields[ll.name]
+		}
+		if ok && value != "" {
+			other[tsdb.LabelName(ll.name)] = []string{ll.value(value)}
+		}
+	}
+	return other
+}
+
+// when returns the time of a sample of the line, false when the line is dropped by the timestamp policy
+func (p *pipeline) when(text string, fields map[string]string) (time.Time, bool) {
+	now := time.Now()
+	if p.timestamp == nil {
+		return now, true
+	}
+	return p.timestamp.find(text, fields, now)
+}
+
+// reach returns the value to send for a match of keyWord, false while the threshold is not crossed
+func (p *pipeline) reach(fileName, keyWord string) (float64, bool) {
+	if p.threshold == nil {
+		return 1, true
+	}
+	observed, fire := p.threshold.Hit(limit.Key(fileName, keyWord), time.Now())
+	return float64(observed), fire
+}
+
+// limitKey is the key of the limiter of a sample of keyWord, every fingerprint of the
+// keyword has its own, as many as the fingerprint label takes values
+func (p *pipeline) limitKey(fileName, keyWord, text string) string {
+	if p.fingerprint == nil {
+		return limit.Key(fileName, keyWord)
+	}
+	return limit.Key(fileName, keyWord+"\x00"+p.fingerprint.peek(fingerprint.Sum(text)))
+}
+
+// collapse holds back a match of keyWord until the window of its fingerprint is over, false when matches are sent at once
+func (p *pipeline) collapse(fileName, keyWord, text string, send func(count int)) bool {
+	if p.dedupe == nil {
+		return false
+	}
+	p.dedupe.Add(limit.Key(fileName, keyWord)+"\x00"+fingerprint.Sum(text), time.Now(), send)
+	return true
+}
+
+// WithAnnotation labels a sample of keyWord with the severity, summary and runbook of rule, keyWord may be empty for the rule as a whole
+func WithAnnotation(rule *conf.List, keyWord string) tsdb.PromOptions {
+	a := rule.Annotation(keyWord)
+	return tsdb.WithAnnotation(a.Severity, a.Summary, a.Runbook)
+}
@@ -2,24 +2,33 @@ package tailkeyword
 
 import (
 	"context"
+	"time"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/absence"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/hpcloud/tail"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/counter"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/check"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/filter"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/follow"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/resolve"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/limit"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/metrics"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/tsdb"
 )
 
 type TailWordInfo struct {
-	L       log.Logger
-	Minute  int
-	Buff    int
-	Pro     tsdb.PromRemoteInterface
-	Limit   limit.LimitInterface
-	Resolve resolve.ResolveInterface
+	L         log.Logger
+	Minute    int
+	Buff      int
+	Pro       tsdb.PromRemoteInterface
+	Limit     limit.LimitInterface
+	Resolve   resolve.ResolveInterface
+	Counter   counter.CounterInterface
+	Histogram counter.HistogramInterface
+	Absence   absence.AbsenceInterface
 }
 
 func NewTailWordInfo(in *TailWordInfo) TailWordInfoInterface {
@@ -27,82 +36,221 @@ func NewTailWordInfo(in *TailWordInfo) TailWordInfoInterface {
 }
 
 type TailWordInfoInterface interface {
-	TailWord(in *TailWordIn, ctx context.Context, filter func(msg string, keywords []string) *string)
+	TailWord(in *TailWordIn, ctx context.Context, hf filter.HaveFilterInterface[string])
 }
 
 type TailWordIn struct {
-	FileName     string
-	ReOpen       bool
-	Follow       bool
-	Offset       int64
-	Whence       int
-	MustExist    bool
-	Poll         bool
+	FileName  string
+	ReOpen    bool
+	Follow    bool
+	Offset    int64
+	Whence    int
+	MustExist bool
+	// read before FileName, it was rotated while nobody followed it
+	Rotated      *Rotated
 	KeyWord      []string
 	ResolvedWord []string
 	RulerName    string
-	AppName      string
-	Ctx          context.Context
+	// the config of AppName
+	Rule    *conf.List
+	AppName string
+	Ctx     context.Context
 }
 
-func (twi *TailWordInfo) TailWord(in *TailWordIn, ctx context.Context, filter func(msg string, keyword []string) *string) {
-	config := tail.Config{
-		Location:  &tail.SeekInfo{Offset: in.Offset, Whence: in.Whence},
-		ReOpen:    in.ReOpen,
-		MustExist: in.MustExist,
-		Poll:      in.Poll,
-		Pipe:      false,
-		Follow:    in.Follow,
-	}
-	tails, err := tail.TailFile(in.FileName, config)
+// Rotated is what is left to read of a rotated file
+type Rotated struct {
+	FileName string
+	Offset   int64
+}
+
+func (twi *TailWordInfo) TailWord(in *TailWordIn, ctx context.Context, hf filter.HaveFilterInterface[string]) {
+	tails, err := follow.NewFollower(in.FileName,
+		follow.WithLocation(in.Offset, in.Whence),
+		follow.WithReOpen(in.ReOpen),
+		follow.WithMustExist(in.MustExist),
+		follow.WithFollow(in.Follow),
+		follow.WithLog(twi.L),
+	)
 	if err != nil {
 		level.Error(twi.L).Log("tail file failed, err", err)
 		return
 	}
 
 	var (
-		line *tail.Line
+		line *follow.Line
 		ok   bool
+		ml   *Multiline
+		// nil channel never fires when multiline is off
+		flushC <-chan time.Time
+		// fires only when repeats are collapsed
+		dedupeC <-chan time.Time
 	)
-	check.Insert(in.FileName, tails)
-	resoFlag := (len(in.ResolvedWord) > 0)
+	check.SetFollower(in.FileName, tails)
+	defer check.Release(in.FileName, tails)
+	p, err := newPipeline(in.Rule, hf)
+	if err != nil {
+		level.Error(twi.L).Log("create pipeline failed, appname is", in.AppName, "err", err)
+		tails.Stop()
+		return
+	}
+	if in.Rule.Multiline != nil {
+		if ml, err = NewMultiline(in.Rule.Multiline); err != nil {
+			level.Error(twi.L).Log("create multiline failed, appname is", in.AppName, "err", err)
+			ml = nil
+		} else {
+			t := time.NewTicker(ml.tick())
+			defer t.Stop()
+			flushC = t.C
+		}
+	}
+	if p.dedupe != nil {
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		dedupeC = t.C
+	}
+	take := func(line *follow.Line) {
+		level.Debug(twi.L).Log("tail content", line.Text)
+		if ml == nil {
+			twi.match(in, line.Text, line.Offset, p)
+			return
+		}
+		if event, eventOffset, ok := ml.Push(line.Text, line.Offset, time.Now()); ok {
+			twi.match(in, event, eventOffset, p)
+		}
+	}
+	if in.Rotated != nil {
+		level.Info(twi.L).Log("catching up rotated file", in.Rotated.FileName, "offset", in.Rotated.Offset, "filename", in.FileName)
+		if err := follow.ReadRotated(in.Rotated.FileName, in.Rotated.Offset, take); err != nil {
+			level.Error(twi.L).Log("read rotated file failed, filename", in.Rotated.FileName, "err", err)
+		}
+	}
 	//var builder strings.Builder
 	/* 	t := time.NewTicker(time.Minute * time.Duration(twi.Minute)) */
 
 	for {
 		select {
-		case line, ok = <-tails.Lines: //遍历chan，读取日志内容
+		case line, ok = <-tails.Lines(): //遍历chan，读取日志内容
+			if !ok {
+				level.Error(twi.L).Log("tail file closed, filename:", tails.Filename(), "err", tails.Stop())
+				return
+			}
+			take(line)
+
+		case now := <-flushC:
+			if ml.Expired(now) {
+				if event, eventOffset, ok := ml.Flush(); ok {
+					twi.match(in, event, eventOffset, p)
+				}
+			}
+
+		case now := <-dedupeC:
+			p.dedupe.Flush(now)
+
+		case <-ctx.Done():
+			if ml != nil {
+				if event, eventOffset, ok := ml.Flush(); ok {
+					twi.match(in, event, eventOffset, p)
+				}
+			}
+			if p.dedupe != nil {
+				p.dedupe.Flush(time.Time{})
+			}
+			if err = tails.Stop(); err != nil {
+				level.Error(twi.L).Log("dying name", tails.Filename(), "err", err)
+				return
+			}
+			level.Debug(twi.L).Log("dying name", tails.Filename())
+			return
+
+		}
+	}
+}
+
+// observe records the number the value rule takes out of a matched line
+func (twi *TailWordInfo) observe(in *TailWordIn, text string, p *pipeline) {
+	if p.value == nil {
+		return
+	}
+	if value, ok := p.value.extract(text); ok {
+		twi.Histogram.Observe(counter.HistogramKey{
+			AppName:   in.AppName,
+			FileName:  in.FileName,
+			RulerName: in.RulerName,
+			Name:      p.value.name,
+		}, p.value.buckets, value)
+	}
+}
+
+func (twi *TailWordInfo) match(in *TailWordIn, text string, offset int64, p *pipeline) {
+	resoFlag := (len(in.ResolvedWord) > 0)
+	fields, err := p.parse(text)
+	if err != nil {
+		level.Debug(twi.L).Log("parse line failed, filename", in.FileName, "err", err)
+	} else if p.valueOnly(in.KeyWord) {
+		// a rule of only a value records every line but the excluded ones
+		if len(p.filter(text, filter.ListExclude, in.Rule.ExcludeKeyWords)) == 0 {
+			twi.observe(in, text, p)
+		}
+	} else if findKeyWords := p.find(text, in.KeyWord, fields); len(findKeyWords) > 0 {
+		if excludeWords := p.filter(text, filter.ListExclude, in.Rule.ExcludeKeyWords); len(excludeWords) > 0 {
+			level.Debug(twi.L).Log("suppressed keywords", findKeyWords, "exclude keywords", excludeWords, "filename", in.FileName)
+			// one line, counted under the first keyword it matched
+			metrics.SuppressedLines.WithLabelValues(in.AppName, findKeyWords[0], excludeWords[0]).Inc()
+			return
+		}
+		ts, ok := p.when(text, fields)
+		if !ok {
+			level.Debug(twi.L).Log("dropped by timestamp policy, filename", in.FileName, "line", text)
+			return
+		}
+		twi.observe(in, text, p)
+		// every keyword, and every fingerprint of it, has its own limiter, so one noisy keyword never hides another
+		for _, v := range findKeyWords {
+			findKeyWord := v
+			twi.Counter.Inc(counter.Key{
+				AppName:   in.AppName,
+				FileName:  in.FileName,
+				KeyWord:   findKeyWord,
+				RulerName: in.RulerName,
+			})
+			if in.Rule.Absence > 0 {
+				twi.Absence.Seen(in.AppName, in.RulerName, in.FileName)
+				continue
+			}
+			value, ok := p.reach(in.FileName, findKeyWord)
 			if !ok {
-				level.Error(twi.L).Log("tail file close reopen, filename:", tails.Filename)
 				continue
 			}
-			level.Debug(twi.L).Log("tail content", line.Text)
-			if findKeyWord := filter(line.Text, in.KeyWord); findKeyWord != nil {
-				twi.Limit.LimitSend(in.FileName, func() {
-					go twi.Pro.Send(float64(1),
+			send := func(value float64) {
+				sample := func() {
+					go twi.Pro.Send(value,
 						tsdb.NewPromLabels(in.AppName, in.FileName, conf.Ip,
-							tsdb.WithOthers(map[string][]string{"keywords": {*findKeyWord},
-								"rulerName": {in.RulerName}}),
+							tsdb.WithOthers(p.extraLabels(text, findKeyWord, fields, map[string][]string{"keywords": {findKeyWord},
+								"rulerName": {in.RulerName}})),
+							WithAnnotation(in.Rule, findKeyWord),
 						).
 							GenLabels(),
+						tsdb.WithTimestamp(ts),
+						tsdb.WithExemplar(text, offset),
 					)
 					if resoFlag {
 						twi.Resolve.Alarm(in.AppName)
 					}
-				})
+				}
+				// a threshold sample comes once every Count matches, the limiter would lose it
+				if p.threshold != nil {
+					sample()
+					return
+				}
+				twi.Limit.LimitSend(p.limitKey(in.FileName, findKeyWord, text), sample)
 			}
-			if resoFlag && filter(line.Text, in.ResolvedWord) != nil {
-				twi.Resolve.Resolve(in.AppName)
-			}
-
-		case <-ctx.Done():
-			if err = tails.Stop(); err != nil {
-				level.Error(twi.L).Log("dying name", tails.Filename, "err", err)
-				return
+			if p.collapse(in.FileName, findKeyWord, text, func(count int) { send(float64(count)) }) {
+				continue
 			}
-			level.Debug(twi.L).Log("dying name", tails.Filename)
-			return
-
+			send(value)
 		}
 	}
+	if resoFlag && len(p.filter(text, filter.ListResolve, in.ResolvedWord)) > 0 {
+		twi.Resolve.Resolve(in.AppName)
+	}
 }
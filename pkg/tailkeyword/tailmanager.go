@@ -6,16 +6,18 @@ import (
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/hpcloud/tail"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/absence"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/counter"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/check"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/filter"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/follow"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/identity"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/resolve"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/savepostion"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/scan"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/limit"
 	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/tsdb"
-	"github.com/zxzixuanwang/log-file-keyword-exporter/tool"
 )
 
 var (
@@ -50,6 +52,14 @@ func getRulerName(appName string) string {
 		return ""
 	}
 }
+
+func getRule(appName string) *conf.List {
+	if rule, ok := conf.ConfigLogFile[appName]; ok {
+		return rule
+	}
+	return &conf.List{AppName: appName}
+}
+
 func (tm *tailManager) Reload(fileDirs []string) error {
 
 	level.Info(tm.l).Log("reloading log", "...")
@@ -69,43 +79,42 @@ func (tm *tailManager) Reload(fileDirs []string) error {
 	level.Debug(tm.l).Log("old dir", oldDir, "same dir", sameDir, "new dir", newDir)
 	for _, v := range oldDir {
 		level.Debug(tm.l).Log("old dir", v)
-		s := check.Get(v)
-
-		tails, ok := s.(*tail.Tail)
-		if !ok {
-			level.Warn(tm.l).Log("cannot get conved tail,content is", s)
+		f, _ := check.Get(v)
+		tails := f.Follower
+		if tails == nil {
+			level.Warn(tm.l).Log("cannot get tail of file", v)
+			check.Stop(v)
 			continue
 		}
-		fileName := tails.Filename
-		ctxAny := check.GetAndDelete(check.KeyCtx(fileName))
-		ctxFunCancel, ok := ctxAny.(context.CancelFunc)
-		if ok {
-			level.Info(tm.l).Log("closing tailing signal，filename is", fileName)
-			ctxFunCancel()
-		}
-		// 删除失效的文件名
-		check.Delete([]string{tails.Filename})
-		// 死亡再次缓存
+		fileName := tails.Filename()
+		// the file is closed once the tail is cancelled, so where it is read is taken first
 		offset, err := tails.Tell()
+		id, iderr := tails.Identity()
+		level.Info(tm.l).Log("closing tailing signal，filename is", v)
+		check.Stop(v)
 		if err != nil {
 			level.Error(tm.l).Log("take dying offset failed", err)
 			continue
 		}
-		appName := check.Get(check.KeyAppName(fileName)).(string)
+		if iderr != nil {
+			level.Warn(tm.l).Log("take identity of dying file failed, filename", fileName, "err", iderr)
+		}
+		appName := f.AppName
 
 		fi := &savepostion.FIInput{
 			FileName: fileName,
 			Offset:   offset,
 			AppName:  appName,
+			Identity: id,
 		}
 		tm.SP.HotSave(fi)
 
-		check.InsertWithClear(check.KeyDyingFile(fileName), offset)
+		check.Die(fileName, offset)
 	}
 
 	for _, v := range newDir {
 		level.Info(tm.l).Log("new dir", v)
-		appName, offset, whence := getFileInfo(tm.l, result, v)
+		appName, offset, whence, rotated := getFileInfo(tm.l, v)
 		level.Debug(tm.l).Log("appname", appName, "offset", offset, "whence", whence)
 
 		keywords, ok := getAppKeyword(appName, tm.l)
@@ -120,24 +129,27 @@ func (tm *tailManager) Reload(fileDirs []string) error {
 			Offset:    offset,
 			Whence:    whence,
 			MustExist: false,
-			Poll:      false,
+			Rotated:   rotated,
 			KeyWord:   keywords,
 			AppName:   appName,
 			Ctx:       ctx,
 			RulerName: getRulerName(appName),
+			Rule:      getRule(appName),
 		}
-		check.Insert(check.KeyCtx(v), cancel)
+		check.SetCancel(v, cancel)
 
+		id, _ := identity.Of(v)
 		tm.SP.HotSave(&savepostion.FIInput{
 			FileName: v,
 			Offset:   offset,
 			AppName:  appName,
+			Identity: id,
 		})
 	}
 
 	for _, v := range sameDir {
 
-		appName, offset, whence := getFileInfo(tm.l, result, v)
+		appName, offset, whence, rotated := getFileInfo(tm.l, v)
 
 		level.Debug(tm.l).Log("appname", appName, "offset", offset, "whence", whence)
 		if tm.First {
@@ -154,19 +166,20 @@ func (tm *tailManager) Reload(fileDirs []string) error {
 				Offset:    offset,
 				Whence:    whence,
 				MustExist: false,
-				Poll:      false,
+				Rotated:   rotated,
 				KeyWord:   keywords,
 				AppName:   appName,
 				Ctx:       ctx,
 				RulerName: getRulerName(appName),
+				Rule:      getRule(appName),
 			}
 
-			check.Insert(check.KeyCtx(v), cancel)
+			check.SetCancel(v, cancel)
 		} else {
-			s := check.Get(v)
-			tails, ok := s.(*tail.Tail)
-			if !ok {
-				level.Warn(tm.l).Log("cannot get conved tail,content is", s)
+			f, _ := check.Get(v)
+			tails := f.Follower
+			if tails == nil {
+				level.Warn(tm.l).Log("cannot get tail of file", v)
 				continue
 			}
 			offset, err := tails.Tell()
@@ -176,10 +189,12 @@ func (tm *tailManager) Reload(fileDirs []string) error {
 			}
 
 			level.Debug(tm.l).Log("filename", v, "offset", offset)
+			id, _ := tails.Identity()
 			fi := &savepostion.FIInput{
 				Offset:   offset,
 				AppName:  appName,
-				FileName: tails.Filename,
+				FileName: tails.Filename(),
+				Identity: id,
 			}
 			tm.SP.HotSave(fi)
 		}
@@ -193,49 +208,69 @@ func (tm *tailManager) Reload(fileDirs []string) error {
 	return nil
 }
 
-func (tm *tailManager) Do(rso resolve.ResolveInterface, pro tsdb.PromRemoteInterface, limit limit.LimitInterface) {
+func (tm *tailManager) Do(rso resolve.ResolveInterface, pro tsdb.PromRemoteInterface, limit limit.LimitInterface,
+	cnt counter.CounterInterface, hist counter.HistogramInterface, abs absence.AbsenceInterface) {
 	go func() {
 		for v := range TailChan {
 			v := v
 			level.Debug(tm.l).Log("ranger", v)
 			ntwi := NewTailWordInfo(&TailWordInfo{
-				L:       tm.l,
-				Minute:  0,
-				Buff:    0,
-				Pro:     pro,
-				Limit:   limit,
-				Resolve: rso,
+				L:         tm.l,
+				Minute:    0,
+				Buff:      0,
+				Pro:       pro,
+				Limit:     limit,
+				Resolve:   rso,
+				Counter:   cnt,
+				Histogram: hist,
+				Absence:   abs,
 			})
-			go ntwi.TailWord(v, v.Ctx, filter.NewFilter(filter.DefaultFilter{}).HaveFilter)
+			hf, err := filter.NewHaveFilter(v.Rule.MatchType, v.KeyWord, v.Rule.ExcludeKeyWords, v.ResolvedWord)
+			if err != nil {
+				level.Error(tm.l).Log("create filter failed, appname is", v.AppName, "err", err)
+				continue
+			}
+			go ntwi.TailWord(v, v.Ctx, hf)
 		}
 	}()
 
 }
 func getAppKeyword(name string, l log.Logger) ([]string, bool) {
-	keywordsInterface := check.Get(name)
-	keywords, ok := keywordsInterface.([]string)
+	keywords, ok := check.KeyWords(name)
 	if !ok {
 		level.Error(l).Log("conv app keyword tailed, appname is", name)
 	}
 	return keywords, ok
 }
 
-func getFileInfo(l log.Logger, result map[string]*savepostion.FileInfo, v string) (appName string, offset int64, whence int) {
+func getFileInfo(l log.Logger, v string) (appName string, offset int64, whence int, rotated *Rotated) {
 
 	// 增加获取死亡的内容
-	newOffset, ok := check.GetAndDelete(check.KeyDyingFile(v)).(int64)
+	newOffset, ok := check.TakeDying(v)
 	if ok {
 		level.Info(l).Log("get died info offset", newOffset)
 
 		offset = newOffset
 	}
 
-	appName = check.Get(check.KeyAppName(v)).(string)
-	if result[appName] != nil {
+	f, _ := check.Get(v)
+	appName = f.AppName
+	if fi, same := savepostion.Lookup(v); fi != nil {
 
-		offset = tool.MaxNumber(offset, result[appName].Offset)
+		// where the last follower stopped is newer than the checkpoint, even when it is smaller
+		if !ok {
+			offset = fi.Offset
+		}
 		whence = 0
 
+		// the file was rotated while nobody followed it, the rest of the old one is read first
+		if !same {
+			if name, ok := follow.FindRotated(v, fi.Identity); ok {
+				level.Info(l).Log("found rotated file", name, "offset", offset, "filename", v)
+				rotated = &Rotated{FileName: name, Offset: offset}
+			}
+			offset = 0
+		}
 	}
 	return
 }
@@ -0,0 +1,180 @@
+package tailkeyword
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+)
+
+const (
+	TimeFormatISO8601 = "iso8601"
+	TimeFormatRFC3339 = "rfc3339"
+	TimeFormatUnix    = "unix"
+	TimeFormatUnixMs  = "unixms"
+	TimeFormatCommon  = "common"
+	TimeFormatSyslog  = "syslog"
+
+	TimePolicyNow  = "now"
+	TimePolicyDrop = "drop"
+
+	// the tsdb refuses samples older than its head block
+	defaultTimeMaxAge = 3600
+)
+
+// where the well known formats are found in a line, a bare number is only taken at the start
+// of the line, elsewhere it is as likely an id; use pattern or field for one in the middle
+var timePatterns = map[string]string{
+	TimeFormatISO8601: `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	TimeFormatRFC3339: `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	TimeFormatUnix:    `^\[?(\d{10}(?:\.\d+)?)\b`,
+	TimeFormatUnixMs:  `^\[?(\d{13})\b`,
+	TimeFormatCommon:  `\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+	TimeFormatSyslog:  `\w{3} +\d{1,2} \d{2}:\d{2}:\d{2}`,
+}
+
+var isoLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z0700",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// timestampRule takes the time a line was written out of the line
+type timestampRule struct {
+	reg      *regexp.Regexp
+	field    string
+	layout   string
+	location *time.Location
+	missing  string
+	tooOld   string
+	maxAge   time.Duration
+}
+
+func newTimestampRule(c *conf.Timestamp) (*timestampRule, error) {
+	tr := &timestampRule{
+		field:   c.Field,
+		layout:  c.Layout,
+		missing: c.Missing,
+		tooOld:  c.TooOld,
+		maxAge:  time.Second * time.Duration(c.MaxAge),
+	}
+	if tr.layout == "" {
+		tr.layout = TimeFormatISO8601
+	}
+	if tr.missing == "" {
+		tr.missing = TimePolicyNow
+	}
+	if tr.tooOld == "" {
+		tr.tooOld = TimePolicyNow
+	}
+	if tr.maxAge <= 0 {
+		tr.maxAge = time.Second * defaultTimeMaxAge
+	}
+	for _, v := range []string{tr.missing, tr.tooOld} {
+		if v != TimePolicyNow && v != TimePolicyDrop {
+			return nil, fmt.Errorf("unknown timestamp policy %q", v)
+		}
+	}
+
+	tr.location = time.Local
+	if c.Location != "" {
+		loc, err := time.LoadLocation(c.Location)
+		if err != nil {
+			return nil, fmt.Errorf("load timestamp location %q failed: %w", c.Location, err)
+		}
+		tr.location = loc
+	}
+
+	pattern := c.Pattern
+	if pattern == "" && tr.field == "" {
+		if p, ok := timePatterns[tr.layout]; ok {
+			pattern = p
+		} else {
+			// a go layout is looked for at the start of the line
+			pattern = "^.{" + strconv.Itoa(len(tr.layout)) + "}"
+		}
+	}
+	if pattern != "" {
+		reg, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compile timestamp pattern %q failed: %w", pattern, err)
+		}
+		tr.reg = reg
+	}
+	return tr, nil
+}
+
+// find returns the time of the line, false when the line has to be dropped
+func (tr *timestampRule) find(text string, fields map[string]string, now time.Time) (time.Time, bool) {
+	var raw string
+	if tr.field != "" {
+		raw = fields[tr.field]
+	} else if sub := tr.reg.FindStringSubmatch(text); sub != nil {
+		raw = sub[0]
+		if len(sub) > 1 {
+			raw = sub[1]
+		}
+	}
+
+	t, err := tr.parse(raw, now)
+	if err != nil {
+		return now, tr.missing != TimePolicyDrop
+	}
+	if now.Sub(t) > tr.maxAge {
+		return now, tr.tooOld != TimePolicyDrop
+	}
+	// a clock ahead of ours is not worth a sample in the future
+	if t.After(now) {
+		return now, true
+	}
+	return t, true
+}
+
+func (tr *timestampRule) parse(raw string, now time.Time) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, errors.New("no timestamp in line")
+	}
+	switch tr.layout {
+	case TimeFormatISO8601, TimeFormatRFC3339:
+		raw = strings.Replace(strings.Replace(raw, "T", " ", 1), ",", ".", 1)
+		var err error
+		for _, v := range isoLayouts {
+			var t time.Time
+			if t, err = time.ParseInLocation(v, raw, tr.location); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, err
+	case TimeFormatUnix:
+		sec, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(int64(sec * 1000)), nil
+	case TimeFormatUnixMs:
+		ms, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.UnixMilli(ms), nil
+	case TimeFormatCommon:
+		return time.Parse("02/Jan/2006:15:04:05 -0700", raw)
+	case TimeFormatSyslog:
+		t, err := time.ParseInLocation("Jan _2 15:04:05", raw, tr.location)
+		if err != nil {
+			return time.Time{}, err
+		}
+		// syslog has no year, a date after now is from last year
+		t = t.AddDate(now.In(tr.location).Year(), 0, 0)
+		if t.After(now.Add(time.Hour * 24)) {
+			t = t.AddDate(-1, 0, 0)
+		}
+		return t, nil
+	default:
+		return time.ParseInLocation(tr.layout, raw, tr.location)
+	}
+}
@@ -0,0 +1,106 @@
+package tailkeyword
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+)
+
+func TestTimestampFormats(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	want := now.Add(-time.Second * 30)
+	unix := strconv.FormatInt(want.Unix(), 10)
+	unixMs := strconv.FormatInt(want.UnixMilli(), 10)
+
+	tests := []struct {
+		name   string
+		c      conf.Timestamp
+		text   string
+		fields map[string]string
+		want   time.Time
+	}{
+		{"iso8601 zulu", conf.Timestamp{}, "x 2026-10-18T11:59:30.125Z error", nil, want.Add(time.Millisecond * 125)},
+		{"iso8601 comma local", conf.Timestamp{Location: "Asia/Shanghai"}, "2026-10-18 19:59:30,5 error", nil, want.Add(time.Millisecond * 500)},
+		{"rfc3339 offset", conf.Timestamp{Layout: TimeFormatRFC3339}, "2026-10-18T13:59:30+02:00 error", nil, want},
+		{"unix", conf.Timestamp{Layout: TimeFormatUnix}, unix + " error", nil, want},
+		{"unix fraction in brackets", conf.Timestamp{Layout: TimeFormatUnix}, "[" + unix + ".25] error", nil, want.Add(time.Millisecond * 250)},
+		{"unixms", conf.Timestamp{Layout: TimeFormatUnixMs}, unixMs + " error", nil, want},
+		{"common", conf.Timestamp{Layout: TimeFormatCommon}, `10.0.0.1 - - [18/Oct/2026:19:59:30 +0800] "GET / HTTP/1.1" 500`, nil, want},
+		{"syslog", conf.Timestamp{Layout: TimeFormatSyslog, Location: "UTC"}, "Oct 18 11:59:30 host app: error", nil, want},
+		{"go layout", conf.Timestamp{Layout: "2006/01/02 15:04:05", Location: "UTC"}, "2026/10/18 11:59:30 error", nil, want},
+		{"pattern group", conf.Timestamp{Layout: TimeFormatUnix, Pattern: `ts=(\d+)`}, "error order=123 ts=" + unix, nil, want},
+		{"field", conf.Timestamp{Layout: TimeFormatUnixMs, Field: "time"}, `{"time":` + unixMs + `}`, map[string]string{"time": unixMs}, want},
+	}
+	for _, v := range tests {
+		tr, err := newTimestampRule(&v.c)
+		if err != nil {
+			t.Fatalf("%s: %v", v.name, err)
+		}
+		got, ok := tr.find(v.text, v.fields, now)
+		if !ok || !got.Equal(v.want) {
+			t.Errorf("%s: %v %v, want %v", v.name, got, ok, v.want)
+		}
+	}
+}
+
+func TestTimestampSyslogLastYear(t *testing.T) {
+	now := time.Date(2027, 1, 1, 0, 30, 0, 0, time.UTC)
+	tr, err := newTimestampRule(&conf.Timestamp{Layout: TimeFormatSyslog, Location: "UTC", MaxAge: 7200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC)
+	if got, ok := tr.find("Dec 31 23:59:00 host app: error", nil, now); !ok || !got.Equal(want) {
+		t.Fatalf("%v %v, want %v", got, ok, want)
+	}
+}
+
+func TestTimestampPolicies(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	line := func(t time.Time) string {
+		return strconv.FormatInt(t.Unix(), 10) + " error"
+	}
+	tests := []struct {
+		name string
+		c    conf.Timestamp
+		text string
+		want time.Time
+		ok   bool
+	}{
+		{"missing now", conf.Timestamp{}, "error", now, true},
+		{"missing drop", conf.Timestamp{Missing: TimePolicyDrop}, "error", time.Time{}, false},
+		// a number in the middle of the line is no time
+		{"id is no unix time", conf.Timestamp{Layout: TimeFormatUnix, Missing: TimePolicyDrop}, "order " + line(now), time.Time{}, false},
+		{"unparsable", conf.Timestamp{Layout: "2006-01-02", Missing: TimePolicyDrop}, "2026-13-45 error", time.Time{}, false},
+		{"too old now", conf.Timestamp{Layout: TimeFormatUnix, MaxAge: 60}, line(now.Add(-time.Minute * 2)), now, true},
+		{"too old drop", conf.Timestamp{Layout: TimeFormatUnix, MaxAge: 60, TooOld: TimePolicyDrop}, line(now.Add(-time.Minute * 2)), time.Time{}, false},
+		{"within max age", conf.Timestamp{Layout: TimeFormatUnix, MaxAge: 60, TooOld: TimePolicyDrop}, line(now.Add(-time.Second * 59)), now.Add(-time.Second * 59), true},
+		{"default max age", conf.Timestamp{Layout: TimeFormatUnix, TooOld: TimePolicyDrop}, line(now.Add(-time.Minute * 61)), time.Time{}, false},
+		{"future", conf.Timestamp{Layout: TimeFormatUnix, Missing: TimePolicyDrop, TooOld: TimePolicyDrop}, line(now.Add(time.Minute)), now, true},
+	}
+	for _, v := range tests {
+		tr, err := newTimestampRule(&v.c)
+		if err != nil {
+			t.Fatalf("%s: %v", v.name, err)
+		}
+		got, ok := tr.find(v.text, nil, now)
+		if ok != v.ok || ok && !got.Equal(v.want) {
+			t.Errorf("%s: %v %v, want %v %v", v.name, got, ok, v.want, v.ok)
+		}
+	}
+}
+
+func TestTimestampRuleErrors(t *testing.T) {
+	for _, c := range []conf.Timestamp{
+		{Missing: "skip"},
+		{TooOld: "keep"},
+		{Location: "Mars/Olympus"},
+		{Pattern: "("},
+	} {
+		if _, err := newTimestampRule(&c); err == nil {
+			t.Errorf("%+v accepted", c)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package tailkeyword
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/counter"
+)
+
+const defaultValueName = "keyword_value"
+
+// seconds of every time unit
+var units = map[string]float64{
+	"ns":  1e-9,
+	"us":  1e-6,
+	"µs":  1e-6,
+	"ms":  1e-3,
+	"s":   1,
+	"m":   60,
+	"min": 60,
+	"h":   3600,
+}
+
+// valueRule takes a number like took 1532ms out of a line and converts it to seconds
+type valueRule struct {
+	name       string
+	reg        *regexp.Regexp
+	valueIndex int
+	unitIndex  int
+	unit       string
+	buckets    []float64
+}
+
+func newValueRule(c *conf.ValueRule) (*valueRule, error) {
+	reg, err := regexp.Compile(c.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compile value pattern %q failed: %w", c.Pattern, err)
+	}
+	vr := &valueRule{
+		name:       c.Name,
+		reg:        reg,
+		valueIndex: reg.SubexpIndex("value"),
+		unitIndex:  reg.SubexpIndex("unit"),
+		unit:       c.Unit,
+		buckets:    c.Buckets,
+	}
+	if vr.valueIndex < 0 {
+		if reg.NumSubexp() == 0 {
+			return nil, errors.New("value pattern " + c.Pattern + " has no capture group")
+		}
+		vr.valueIndex = 1
+	}
+	if _, ok := units[vr.unit]; vr.unit != "" && !ok {
+		return nil, fmt.Errorf("unknown value unit %q", vr.unit)
+	}
+	if vr.name == "" {
+		vr.name = defaultValueName
+	}
+	if len(vr.buckets) == 0 {
+		vr.buckets = counter.DefBuckets
+	} else {
+		vr.buckets = append([]float64(nil), vr.buckets...)
+		sort.Float64s(vr.buckets)
+	}
+	return vr, nil
+}
+
+func (vr *valueRule) extract(text string) (float64, bool) {
+	sub := vr.reg.FindStringSubmatch(text)
+	if sub == nil {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(sub[vr.valueIndex], 64)
+	if err != nil {
+		return 0, false
+	}
+	unit := vr.unit
+	if vr.unitIndex > 0 && sub[vr.unitIndex] != "" {
+		unit = sub[vr.unitIndex]
+	}
+	if unit == "" {
+		return value, true
+	}
+	scale, ok := units[unit]
+	if !ok {
+		return 0, false
+	}
+	return value * scale, true
+}
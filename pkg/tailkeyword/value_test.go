@@ -0,0 +1,74 @@
+package tailkeyword
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/counter"
+)
+
+func TestValueExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		c    conf.ValueRule
+		text string
+		want float64
+		ok   bool
+	}{
+		{"first group", conf.ValueRule{Pattern: `took (\d+)`}, "request took 1532 bytes", 1532, true},
+		{"first group with unit", conf.ValueRule{Pattern: `took (\d+)`, Unit: "ms"}, "request took 1532", 1.532, true},
+		{"named value", conf.ValueRule{Pattern: `id=(\d+) took=(?P<value>[\d.]+)`}, "id=7 took=0.25", 0.25, true},
+		{"unit of the line", conf.ValueRule{Pattern: `took (?P<value>[\d.]+)(?P<unit>\w+)`}, "took 1.5s", 1.5, true},
+		{"unit of the line wins", conf.ValueRule{Pattern: `took (?P<value>\d+)(?P<unit>\w*)`, Unit: "s"}, "took 2min", 120, true},
+		{"no unit in the line", conf.ValueRule{Pattern: `took (?P<value>\d+)(?P<unit>\w*)`, Unit: "ms"}, "took 250", 0.25, true},
+		{"microseconds", conf.ValueRule{Pattern: `(?P<value>\d+)(?P<unit>µs|us)`}, "took 30µs", 30e-6, true},
+		{"hours", conf.ValueRule{Pattern: `(?P<value>\d+)(?P<unit>h)`}, "uptime 2h", 7200, true},
+		{"nanoseconds", conf.ValueRule{Pattern: `(?P<value>\d+)(?P<unit>ns)`}, "took 500ns", 500e-9, true},
+		{"unknown unit of the line", conf.ValueRule{Pattern: `took (?P<value>\d+)(?P<unit>\w+)`}, "took 3days", 0, false},
+		{"no match", conf.ValueRule{Pattern: `took (\d+)`}, "request done", 0, false},
+		{"not a number", conf.ValueRule{Pattern: `took (\S+)`}, "took fast", 0, false},
+	}
+	for _, v := range tests {
+		vr, err := newValueRule(&v.c)
+		if err != nil {
+			t.Fatalf("%s: %v", v.name, err)
+		}
+		got, ok := vr.extract(v.text)
+		if ok != v.ok || math.Abs(got-v.want) > 1e-12 {
+			t.Errorf("%s: %v %v, want %v %v", v.name, got, ok, v.want, v.ok)
+		}
+	}
+}
+
+func TestValueRuleDefaults(t *testing.T) {
+	vr, err := newValueRule(&conf.ValueRule{Pattern: `(\d+)`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vr.name != defaultValueName || !reflect.DeepEqual(vr.buckets, counter.DefBuckets) {
+		t.Fatalf("name %q buckets %v", vr.name, vr.buckets)
+	}
+
+	// buckets are sorted without touching the config
+	c := &conf.ValueRule{Pattern: `(\d+)`, Name: "latency", Buckets: []float64{5, 1, 2}}
+	if vr, err = newValueRule(c); err != nil {
+		t.Fatal(err)
+	}
+	if vr.name != "latency" || !reflect.DeepEqual(vr.buckets, []float64{1, 2, 5}) || c.Buckets[0] != 5 {
+		t.Fatalf("name %q buckets %v, config %v", vr.name, vr.buckets, c.Buckets)
+	}
+}
+
+func TestValueRuleErrors(t *testing.T) {
+	for _, c := range []conf.ValueRule{
+		{Pattern: `took \d+`},
+		{Pattern: `took (\d+`},
+		{Pattern: `took (\d+)`, Unit: "days"},
+	} {
+		if _, err := newValueRule(&c); err == nil {
+			t.Errorf("%+v accepted", c)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package tsdb
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+const (
+	// prometheus drops an exemplar whose label names and values are longer in total
+	ExemplarMaxRunes = 128
+
+	ExemplarLine   = "line"
+	ExemplarOffset = "offset"
+)
+
+// WithExemplar attaches line and where it starts in the file to the sample, a negative offset is left out
+func WithExemplar(line string, offset int64) SendOptions {
+	return func(si *sendInfo) {
+		si.exemplar = ExemplarLabels(line, offset)
+	}
+}
+
+// ExemplarLabels cuts line to what is left of ExemplarMaxRunes by the other labels
+func ExemplarLabels(line string, offset int64) []prompb.Label {
+	labels := make([]prompb.Label, 0, 2)
+	room := ExemplarMaxRunes - len(ExemplarLine)
+	if offset >= 0 {
+		off := strconv.FormatInt(offset, 10)
+		labels = append(labels, prompb.Label{Name: ExemplarOffset, Value: off})
+		room -= len(ExemplarOffset) + len(off)
+	}
+	return append(labels, prompb.Label{Name: ExemplarLine, Value: sanitise(line, room)})
+}
+
+// sanitise folds control characters and runs of spaces of line into one space and cuts it to max runes
+func sanitise(line string, max int) string {
+	line = strings.ToValidUTF8(line, string(utf8.RuneError))
+	runes := make([]rune, 0, len(line))
+	space := false
+	for _, r := range line {
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			space = len(runes) > 0
+			continue
+		}
+		if space {
+			runes = append(runes, ' ')
+			space = false
+		}
+		runes = append(runes, r)
+	}
+	if len(runes) > max {
+		runes = append(runes[:max-1], '…')
+	}
+	return string(runes)
+}
@@ -1,6 +1,8 @@
 package tsdb
 
 import (
+	"strings"
+
 	"github.com/prometheus/prometheus/prompb"
 )
 
@@ -10,6 +12,9 @@ type PromLabels struct {
 	IPinfo      string
 	Other       map[string][]string
 	MetricsName string
+	Severity    string
+	Summary     string
+	Runbook     string
 }
 
 type PromOptions func(*PromLabels)
@@ -35,6 +40,47 @@ func WithOthers(other map[string][]string) PromOptions {
 	}
 }
 
+// labels the exporter sets itself, one of them taken from a line would be sent twice or replace the real one
+var reservedLabels = map[string]bool{
+	LABEL_NAME:     true,
+	"app_name":     true,
+	"log_position": true,
+	"instance":     true,
+	"severity":     true,
+	"summary":      true,
+	"runbook":      true,
+	"keywords":     true,
+	"rulerName":    true,
+	"absent":       true,
+	"le":           true,
+}
+
+// ReservedLabel reports whether name is set by the exporter or reserved by prometheus
+func ReservedLabel(name string) bool {
+	return reservedLabels[name] || strings.HasPrefix(name, "__")
+}
+
+// LabelName replaces the characters prometheus does not allow in a label name
+func LabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		b[i] = '_'
+	}
+	return string(b)
+}
+
+// WithAnnotation adds severity, summary and runbook labels, the empty ones are left out
+func WithAnnotation(severity, summary, runbook string) PromOptions {
+	return func(pli *PromLabels) {
+		pli.Severity = severity
+		pli.Summary = summary
+		pli.Runbook = runbook
+	}
+}
+
 func (pl *PromLabels) GenLabels() []prompb.Label {
 	tempLabels := []prompb.Label{
 		{
@@ -51,6 +97,16 @@ func (pl *PromLabels) GenLabels() []prompb.Label {
 		},
 	}
 
+	for _, v := range []prompb.Label{
+		{Name: "severity", Value: pl.Severity},
+		{Name: "summary", Value: pl.Summary},
+		{Name: "runbook", Value: pl.Runbook},
+	} {
+		if v.Value != "" {
+			tempLabels = append(tempLabels, v)
+		}
+	}
+
 	if len(pl.Other) > 0 {
 		res := make([]prompb.Label, 0, len(pl.Other)+2)
 		for k, v := range pl.Other {
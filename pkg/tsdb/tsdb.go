@@ -38,6 +38,8 @@ type PromRemote struct {
 	client       api.Client
 }
 type Request struct {
+	// overrides the metric name of SendBatch, e.g. the _bucket series of a histogram
+	Name      string
 	Value     float64
 	NewLabels []prompb.Label
 }
@@ -129,34 +131,56 @@ func NewProRemote(opt ...Options) (PromRemoteInterface, error) {
 	return pr, nil
 }
 
+type SendOptions func(*sendInfo)
+
+type sendInfo struct {
+	timestamp time.Time
+	exemplar  []prompb.Label
+}
+
+// WithTimestamp sends the sample at t instead of now
+func WithTimestamp(t time.Time) SendOptions {
+	return func(si *sendInfo) {
+		si.timestamp = t
+	}
+}
+
 type PromRemoteInterface interface {
-	Send(value float64, newLabels []prompb.Label)
+	Send(value float64, newLabels []prompb.Label, opt ...SendOptions)
+	// SendBatch sends every request as a series of metricName in one remote write
+	SendBatch(metricName, help string, metricType prompb.MetricMetadata_MetricType, batch []Request)
 }
 
-func (pr *PromRemote) Send(value float64, newLabels []prompb.Label) {
+func (pr *PromRemote) Send(value float64, newLabels []prompb.Label, opt ...SendOptions) {
 
 	level.Debug(pr.l).Log("labels", newLabels)
-	header := map[string]string{
-		"User-Agent":                        pr.UA,
-		"Content-Encoding":                  "snappy",
-		"Content-Type":                      "application/x-protobuf",
-		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	si := &sendInfo{timestamp: time.Now()}
+	for _, o := range opt {
+		o(si)
 	}
 
 	newLabels = append(newLabels, prompb.Label{
 		Name:  LABEL_NAME,
 		Value: pr.CounterName,
 	})
+	ts := prompb.TimeSeries{
+		Labels: newLabels,
+		Samples: []prompb.Sample{
+			{
+				Value:     value,
+				Timestamp: si.timestamp.UnixMilli(),
+			},
+		}}
+	if len(si.exemplar) > 0 {
+		ts.Exemplars = []prompb.Exemplar{{
+			Labels:    si.exemplar,
+			Value:     value,
+			Timestamp: si.timestamp.UnixMilli(),
+		}}
+	}
 	// Create a new Prometheus write request.
 	writeRequest := &prompb.WriteRequest{
-		Timeseries: []prompb.TimeSeries{{
-			Labels: newLabels,
-			Samples: []prompb.Sample{
-				{
-					Value:     value,
-					Timestamp: time.Now().UnixMilli(),
-				},
-			}}},
+		Timeseries: []prompb.TimeSeries{ts},
 
 		Metadata: []prompb.MetricMetadata{{
 			Type:             prompb.MetricMetadata_HISTOGRAM,
@@ -164,6 +188,51 @@ func (pr *PromRemote) Send(value float64, newLabels []prompb.Label) {
 			Help:             pr.Help,
 		}},
 	}
+	pr.write(writeRequest, newLabels)
+}
+
+func (pr *PromRemote) SendBatch(metricName, help string, metricType prompb.MetricMetadata_MetricType, batch []Request) {
+	if len(batch) == 0 {
+		return
+	}
+	now := time.Now().UnixMilli()
+	writeRequest := &prompb.WriteRequest{
+		Timeseries: make([]prompb.TimeSeries, 0, len(batch)),
+		Metadata: []prompb.MetricMetadata{{
+			Type:             metricType,
+			MetricFamilyName: metricName,
+			Help:             help,
+		}},
+	}
+	for _, v := range batch {
+		name := metricName
+		if v.Name != "" {
+			name = v.Name
+		}
+		writeRequest.Timeseries = append(writeRequest.Timeseries, prompb.TimeSeries{
+			Labels: append(v.NewLabels, prompb.Label{
+				Name:  LABEL_NAME,
+				Value: name,
+			}),
+			Samples: []prompb.Sample{
+				{
+					Value:     v.Value,
+					Timestamp: now,
+				},
+			},
+		})
+	}
+	level.Debug(pr.l).Log("batch", metricName, "series", len(batch))
+	pr.write(writeRequest, metricName)
+}
+
+func (pr *PromRemote) write(writeRequest *prompb.WriteRequest, list any) {
+	header := map[string]string{
+		"User-Agent":                        pr.UA,
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	}
 
 	data, err := writeRequest.Marshal()
 	if err != nil {
@@ -182,24 +251,25 @@ func (pr *PromRemote) Send(value float64, newLabels []prompb.Label) {
 	if err != nil {
 		level.Warn(pr.l).Log("发送请求失败", err, "进入重试", "10 second")
 		nt := time.NewTicker(time.Second * 10)
+		defer nt.Stop()
 
 		for {
 			select {
 			case <-nt.C:
-				level.Debug(pr.l).Log("重试发送", "10 seconds", "list", newLabels)
+				level.Debug(pr.l).Log("重试发送", "10 seconds", "list", list)
 
 				err = pr.post(data, ctx, header)
 				if err == nil {
-					level.Info(pr.l).Log("重试发送", "成功", "list", newLabels)
+					level.Info(pr.l).Log("重试发送", "成功", "list", list)
 					return
 				}
 			case <-ctx.Done():
-				level.Error(pr.l).Log("发送请求错误", "超时", "list", newLabels)
+				level.Error(pr.l).Log("发送请求错误", "超时", "list", list)
 				return
 			}
 		}
 	} else {
-		level.Info(pr.l).Log("发送tsdb", "成功", "list", newLabels)
+		level.Info(pr.l).Log("发送tsdb", "成功", "list", list)
 	}
 }
 
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/spf13/pflag"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/identity"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/savepostion"
+)
+
+const positionsUsage = `usage: keyword-exporter [-c config] positions <command>
+
+commands:
+  list                          show every checkpoint
+  set --file F --offset N       read F from offset N on the next start, --app names the app of a new checkpoint
+  reset --app A                 forget the checkpoints of app A, its files are read from the start
+  export [--out F]              write the checkpoints as json to F or stdout
+  import [--in F]               replace the checkpoints with the json of F or stdin
+`
+
+var positionCommands = map[string]bool{"list": true, "set": true, "reset": true, "export": true, "import": true}
+
+// positionArgs are the arguments after the positions subcommand, the global flags before it are left to conf
+func positionArgs() []string {
+	for i, v := range os.Args[1:] {
+		if v == "positions" {
+			return os.Args[i+2:]
+		}
+	}
+	return nil
+}
+
+// positionsCommand edits the position store of a stopped exporter and returns the exit code
+func positionsCommand(args []string) int {
+	if len(args) == 0 || !positionCommands[args[0]] {
+		fmt.Fprint(os.Stderr, positionsUsage)
+		return 2
+	}
+	fs := pflag.NewFlagSet("positions "+args[0], pflag.ContinueOnError)
+	var (
+		file   = fs.String("file", "", "log file")
+		offset = fs.Int64("offset", -1, "byte offset to read the file from")
+		app    = fs.String("app", "", "app name")
+		in     = fs.String("in", "", "json file to import, default stdin")
+		out    = fs.String("out", "", "json file to export to, default stdout")
+	)
+	if err := fs.Parse(args[1:]); err != nil {
+		fmt.Fprint(os.Stderr, positionsUsage)
+		return 2
+	}
+
+	pl := level.NewFilter(log.NewLogfmtLogger(os.Stderr), level.AllowWarn())
+	sp, err := savepostion.NewSavePos(conf.AppConfig.LogFile.PositionDir, pl,
+		savepostion.WithStore(conf.AppConfig.LogFile.PositionStore))
+	if err != nil {
+		if errors.Is(err, savepostion.ErrLocked) {
+			fmt.Fprintln(os.Stderr, "refused, stop the exporter first:", err)
+		} else {
+			fmt.Fprintln(os.Stderr, "open position store failed:", err)
+		}
+		return 1
+	}
+	defer sp.Close()
+	positions := sp.Load(true)
+
+	switch args[0] {
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "APP\tFILE\tOFFSET\tIDENTITY")
+		for _, v := range sortPositions(positions) {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", v.AppName, v.FileName, v.Offset, v.Identity.Key())
+		}
+		w.Flush()
+		return 0
+
+	case "set":
+		if *file == "" || *offset < 0 {
+			fmt.Fprintln(os.Stderr, "set needs --file and --offset")
+			return 2
+		}
+		fi := &savepostion.FIInput{FileName: *file, Offset: *offset, AppName: *app}
+		if old, _ := savepostion.Lookup(*file); old != nil && fi.AppName == "" {
+			fi.AppName = old.AppName
+		}
+		if fi.AppName == "" {
+			fmt.Fprintln(os.Stderr, "no checkpoint of", *file, "yet, name its app with --app")
+			return 2
+		}
+		// the offset is of the file behind the name now
+		if id, err := identity.Of(*file); err == nil {
+			fi.Identity = id
+		}
+		sp.HotSave(fi)
+
+	case "reset":
+		if *app == "" {
+			fmt.Fprintln(os.Stderr, "reset needs --app")
+			return 2
+		}
+		n := sp.Delete(func(fi *savepostion.FileInfo) bool {
+			return fi.AppName == *app
+		})
+		fmt.Fprintln(os.Stderr, "forgot", n, "checkpoints of", *app)
+
+	case "export":
+		w := io.Writer(os.Stdout)
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "create export file failed:", err)
+				return 1
+			}
+			defer f.Close()
+			w = f
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(sortPositions(positions)); err != nil {
+			fmt.Fprintln(os.Stderr, "export failed:", err)
+			return 1
+		}
+		return 0
+
+	case "import":
+		r := io.Reader(os.Stdin)
+		if *in != "" {
+			f, err := os.Open(*in)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "open import file failed:", err)
+				return 1
+			}
+			defer f.Close()
+			r = f
+		}
+		var list []*savepostion.FileInfo
+		if err := json.NewDecoder(r).Decode(&list); err != nil {
+			fmt.Fprintln(os.Stderr, "import failed:", err)
+			return 1
+		}
+		sp.Delete(func(*savepostion.FileInfo) bool { return true })
+		for _, v := range list {
+			sp.HotSave(&savepostion.FIInput{
+				FileName: v.FileName,
+				Offset:   v.Offset,
+				AppName:  v.AppName,
+				Identity: v.Identity,
+			})
+		}
+		fmt.Fprintln(os.Stderr, "imported", len(list), "checkpoints")
+	}
+
+	if _, err := sp.PatchSave(nil); err != nil {
+		fmt.Fprintln(os.Stderr, "save position store failed:", err)
+		return 1
+	}
+	return 0
+}
+
+func sortPositions(positions map[string]*savepostion.FileInfo) []*savepostion.FileInfo {
+	list := make([]*savepostion.FileInfo, 0, len(positions))
+	for _, v := range positions {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].AppName != list[j].AppName {
+			return list[i].AppName < list[j].AppName
+		}
+		return list[i].FileName < list[j].FileName
+	})
+	return list
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/conf"
+	"github.com/zxzixuanwang/log-file-keyword-exporter/pkg/file/savepostion"
+)
+
+// runPositions runs the positions subcommand with args and returns its exit code and what it wrote to stdout
+func runPositions(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	out, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	code := positionsCommand(args)
+	os.Stdout = stdout
+
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(content)
+}
+
+func exported(t *testing.T) []*savepostion.FileInfo {
+	t.Helper()
+	code, out := runPositions(t, "export")
+	if code != 0 {
+		t.Fatalf("export exit %d", code)
+	}
+	var list []*savepostion.FileInfo
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		t.Fatalf("export %q: %v", out, err)
+	}
+	return list
+}
+
+func TestPositionsCommand(t *testing.T) {
+	dir := t.TempDir()
+	conf.AppConfig = &conf.Config{LogFile: &conf.LogFile{PositionDir: filepath.Join(dir, "position.json")}}
+	logA := filepath.Join(dir, "a.log")
+	logB := filepath.Join(dir, "b.log")
+	for _, v := range []string{logA, logB} {
+		if err := os.WriteFile(v, []byte("line\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backup := filepath.Join(dir, "backup.json")
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		// app:file:offset of every checkpoint after the command, sorted like list
+		want []string
+	}{
+		{"set needs an app for a new file", []string{"set", "--file", logA, "--offset", "3"}, 2, nil},
+		{"set needs an offset", []string{"set", "--file", logA, "--app", "a"}, 2, nil},
+		{"set", []string{"set", "--file", logA, "--offset", "3", "--app", "a"}, 0, []string{"a:" + logA + ":3"}},
+		{"set keeps the app", []string{"set", "--file", logA, "--offset", "5"}, 0, []string{"a:" + logA + ":5"}},
+		{"set another app", []string{"set", "--file", logB, "--offset", "2", "--app", "b"}, 0, []string{"a:" + logA + ":5", "b:" + logB + ":2"}},
+		{"export to file", []string{"export", "--out", backup}, 0, []string{"a:" + logA + ":5", "b:" + logB + ":2"}},
+		{"reset needs an app", []string{"reset"}, 2, []string{"a:" + logA + ":5", "b:" + logB + ":2"}},
+		{"reset", []string{"reset", "--app", "a"}, 0, []string{"b:" + logB + ":2"}},
+		{"import replaces", []string{"import", "--in", backup}, 0, []string{"a:" + logA + ":5", "b:" + logB + ":2"}},
+		{"import of a missing file", []string{"import", "--in", filepath.Join(dir, "missing.json")}, 1, []string{"a:" + logA + ":5", "b:" + logB + ":2"}},
+		{"unknown command", []string{"drop"}, 2, []string{"a:" + logA + ":5", "b:" + logB + ":2"}},
+		{"no command", nil, 2, []string{"a:" + logA + ":5", "b:" + logB + ":2"}},
+		{"unknown flag", []string{"list", "--force"}, 2, []string{"a:" + logA + ":5", "b:" + logB + ":2"}},
+	}
+	for _, v := range tests {
+		if code, _ := runPositions(t, v.args...); code != v.code {
+			t.Fatalf("%s: exit %d, want %d", v.name, code, v.code)
+		}
+		got := make([]string, 0, len(v.want))
+		for _, fi := range exported(t) {
+			got = append(got, fi.AppName+":"+fi.FileName+":"+strconv.FormatInt(fi.Offset, 10))
+		}
+		if strings.Join(got, ",") != strings.Join(v.want, ",") {
+			t.Fatalf("%s: checkpoints %v, want %v", v.name, got, v.want)
+		}
+	}
+
+	code, out := runPositions(t, "list")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if code != 0 || len(lines) != 3 || !strings.HasPrefix(lines[0], "APP") ||
+		!strings.Contains(lines[1], logA) || !strings.Contains(lines[2], logB) {
+		t.Fatalf("list exit %d:\n%s", code, out)
+	}
+}
+
+func TestPositionsCommandLocked(t *testing.T) {
+	dir := t.TempDir()
+	conf.AppConfig = &conf.Config{LogFile: &conf.LogFile{PositionDir: filepath.Join(dir, "position.json")}}
+
+	// the running exporter holds the store
+	sp, err := savepostion.NewSavePos(conf.AppConfig.LogFile.PositionDir, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"list"}, {"reset", "--app", "a"}} {
+		if code, _ := runPositions(t, args...); code != 1 {
+			t.Errorf("%v: exit %d while locked", args, code)
+		}
+	}
+	sp.Close()
+	if code, _ := runPositions(t, "list"); code != 0 {
+		t.Fatalf("exit %d after the exporter stopped", code)
+	}
+}